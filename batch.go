@@ -0,0 +1,239 @@
+package bitfab
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default batching parameters used when a BatchOptions field is left at zero.
+const (
+	DefaultMaxBatchSize  = 100
+	DefaultFlushInterval = 1 * time.Second
+	DefaultMaxQueueSize  = 2048
+	DefaultBatchWorkers  = 4
+)
+
+// BatchOptions configures batched span delivery. See WithBatching and
+// WithOTLPBatching.
+type BatchOptions struct {
+	// MaxBatchSize is the number of queued spans at which delivery starts
+	// without waiting for FlushInterval. The OTLP exporter sends up to
+	// MaxBatchSize spans per request. The Bitfab API has no batch endpoint,
+	// so the HTTP exporter still sends one request per span.
+	MaxBatchSize int
+	// FlushInterval is the maximum time a span waits in the queue before
+	// the current batch is sent.
+	FlushInterval time.Duration
+	// MaxQueueSize bounds the number of spans waiting to be batched.
+	// Spans exported while the queue is full are dropped.
+	MaxQueueSize int
+	// Workers is the number of goroutines delivering spans, which bounds
+	// the export requests in flight. While all workers are busy, spans wait
+	// in the queue.
+	Workers int
+}
+
+func (o BatchOptions) withDefaults() BatchOptions {
+	if o.MaxBatchSize <= 0 {
+		o.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = DefaultFlushInterval
+	}
+	if o.MaxQueueSize <= 0 {
+		o.MaxQueueSize = DefaultMaxQueueSize
+	}
+	if o.Workers <= 0 {
+		o.Workers = DefaultBatchWorkers
+	}
+	return o
+}
+
+// queuedSpan is a span payload waiting in the batch queue. done is closed
+// once the span has been delivered (or dropped).
+type queuedSpan struct {
+	payload map[string]any
+	done    chan struct{}
+}
+
+// spanBatcher buffers span payloads in a bounded queue and hands them to a
+// fixed pool of workers, either when MaxBatchSize is reached, every
+// FlushInterval, or when a local root span ends. Each worker delivers one
+// batch at a time, so at most Workers requests are in flight.
+type spanBatcher struct {
+	opts  BatchOptions
+	wg    *sync.WaitGroup // the exporter's in-flight deliveries
+	stats *deliveryStats
+	// perDelivery is the maximum number of spans handed to deliver at once;
+	// larger batches are split.
+	perDelivery int
+	// deliver sends a batch. It runs on a worker and must close each span's
+	// done channel and release it from spansPending.
+	deliver func(batch []queuedSpan)
+
+	queue   chan queuedSpan
+	jobs    chan []queuedSpan
+	flushCh chan chan struct{}
+	kick    chan struct{} // requests a flush without waiting for it
+	stopCh  chan struct{}
+	stopped atomic.Bool
+	once    sync.Once
+}
+
+func newSpanBatcher(opts BatchOptions, wg *sync.WaitGroup, stats *deliveryStats, perDelivery int, deliver func(batch []queuedSpan)) *spanBatcher {
+	opts = opts.withDefaults()
+	if perDelivery <= 0 || perDelivery > opts.MaxBatchSize {
+		perDelivery = opts.MaxBatchSize
+	}
+	b := &spanBatcher{
+		opts:        opts,
+		wg:          wg,
+		stats:       stats,
+		perDelivery: perDelivery,
+		deliver:     deliver,
+		queue:       make(chan queuedSpan, opts.MaxQueueSize),
+		jobs:        make(chan []queuedSpan),
+		flushCh:     make(chan chan struct{}),
+		kick:        make(chan struct{}, 1),
+		stopCh:      make(chan struct{}),
+	}
+	for i := 0; i < opts.Workers; i++ {
+		go b.work()
+	}
+	go b.run()
+	return b
+}
+
+// enqueue adds a span to the queue and returns a channel that is closed when
+// the span has been delivered. If the queue is full the span is dropped and
+// the returned channel is already closed.
+func (b *spanBatcher) enqueue(payload map[string]any) <-chan struct{} {
+	item := queuedSpan{payload: payload, done: make(chan struct{})}
+	if b.stopped.Load() {
+		b.stats.spansDropped.Add(1)
+		log.Printf("bitfab: span exporter is shut down, dropping span")
+		close(item.done)
+		return item.done
+	}
+	select {
+	case b.queue <- item:
+		b.stats.spansPending.Add(1)
+	default:
+		b.stats.spansDropped.Add(1)
+		log.Printf("bitfab: span queue full (%d), dropping span", b.opts.MaxQueueSize)
+		close(item.done)
+		return item.done
+	}
+	return item.done
+}
+
+// queueFlusher is implemented by exporters that hold spans in a queue. A local
+// root span calls flushQueue once its trace's spans have been exported, so
+// they are sent without waiting for the flush interval. flushQueue must not
+// block.
+type queueFlusher interface {
+	flushQueue()
+}
+
+// flushSoon asks the worker to send everything currently queued, without
+// waiting. Requests made while one is already pending are coalesced.
+func (b *spanBatcher) flushSoon() {
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+}
+
+// flush sends everything currently queued and returns once the resulting
+// batches have been handed to the workers. Callers wait on the exporter's
+// WaitGroup for those deliveries to finish.
+func (b *spanBatcher) flush() {
+	ack := make(chan struct{})
+	select {
+	case b.flushCh <- ack:
+		<-ack
+	case <-b.stopCh:
+	}
+}
+
+// stop sends everything currently queued and terminates the workers once
+// they have delivered it. Spans enqueued afterwards are dropped.
+func (b *spanBatcher) stop() {
+	b.once.Do(func() {
+		b.stopped.Store(true)
+		b.flush()
+		close(b.stopCh)
+	})
+}
+
+// work delivers batches until the batcher is stopped.
+func (b *spanBatcher) work() {
+	for batch := range b.jobs {
+		func() {
+			defer b.wg.Done()
+			b.deliver(batch)
+		}()
+	}
+}
+
+func (b *spanBatcher) run() {
+	defer close(b.jobs)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]queuedSpan, 0, b.opts.MaxBatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		b.send(batch)
+		batch = make([]queuedSpan, 0, b.opts.MaxBatchSize)
+	}
+	drain := func() {
+		for {
+			select {
+			case item := <-b.queue:
+				batch = append(batch, item)
+				if len(batch) >= b.opts.MaxBatchSize {
+					send()
+				}
+			default:
+				send()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case item := <-b.queue:
+			batch = append(batch, item)
+			if len(batch) >= b.opts.MaxBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case <-b.kick:
+			drain()
+		case ack := <-b.flushCh:
+			drain()
+			close(ack)
+		case <-b.stopCh:
+			return
+		}
+	}
+}
+
+// send hands a batch to the workers, split into deliveries of at most
+// perDelivery spans. It blocks while all workers are busy, so spans back up
+// in the bounded queue instead of starting more requests.
+func (b *spanBatcher) send(batch []queuedSpan) {
+	for len(batch) > 0 {
+		n := min(len(batch), b.perDelivery)
+		b.wg.Add(1)
+		b.jobs <- batch[:n:n]
+		batch = batch[n:]
+	}
+}
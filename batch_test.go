@@ -0,0 +1,233 @@
+package bitfab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// batchCaptureServer records every span and trace completion, and the
+// highest number of span requests it served concurrently.
+type batchCaptureServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	spans       []map[string]any
+	traces      []map[string]any
+	order       []string
+	inFlight    int
+	maxInFlight int
+}
+
+func newBatchCaptureServer(t *testing.T) *batchCaptureServer {
+	t.Helper()
+	s := &batchCaptureServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/externalSpans"):
+			s.mu.Lock()
+			s.inFlight++
+			s.maxInFlight = max(s.maxInFlight, s.inFlight)
+			s.mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			s.mu.Lock()
+			s.inFlight--
+			s.spans = append(s.spans, payload)
+			s.order = append(s.order, "span")
+			s.mu.Unlock()
+		case strings.Contains(r.URL.Path, "externalTraces"):
+			s.mu.Lock()
+			s.traces = append(s.traces, payload)
+			s.order = append(s.order, "trace")
+			s.mu.Unlock()
+		default:
+			t.Errorf("unexpected request to %s", r.URL.Path)
+		}
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	}))
+	return s
+}
+
+func (s *batchCaptureServer) spanCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.spans)
+}
+
+func TestBatching_BoundsRequestsInFlight(t *testing.T) {
+	server := newBatchCaptureServer(t)
+	defer server.Close()
+
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithBatching(BatchOptions{FlushInterval: time.Millisecond, Workers: 2}))
+	ctx := context.Background()
+
+	// Many traces ending at once each ask for a flush while earlier spans
+	// are still being delivered.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Span(ctx, "outer", func(ctx context.Context) (any, error) {
+				return client.Span(ctx, "inner", func(ctx context.Context) (any, error) {
+					return nil, nil
+				})
+			})
+		}()
+	}
+	wg.Wait()
+	client.FlushTraces(5 * time.Second)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if len(server.spans) != 40 {
+		t.Fatalf("expected 40 spans, got %d", len(server.spans))
+	}
+	if server.maxInFlight > 2 {
+		t.Errorf("expected at most 2 span requests in flight, got %d", server.maxInFlight)
+	}
+	for _, sp := range server.spans {
+		if sp["sdkVersion"] != Version {
+			t.Errorf("span sdkVersion = %v, want %v", sp["sdkVersion"], Version)
+		}
+		if _, ok := sp["rawSpan"].(map[string]any); !ok {
+			t.Error("batched span is missing rawSpan")
+		}
+	}
+}
+
+func TestBatching_TraceCompletionAfterSpans(t *testing.T) {
+	server := newBatchCaptureServer(t)
+	defer server.Close()
+
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithBatching(BatchOptions{MaxBatchSize: 2, FlushInterval: time.Hour}))
+	ctx := context.Background()
+
+	client.Span(ctx, "outer", func(ctx context.Context) (any, error) {
+		for i := 0; i < 3; i++ {
+			client.Span(ctx, "inner", func(ctx context.Context) (any, error) {
+				return nil, nil
+			})
+		}
+		return nil, nil
+	})
+
+	client.FlushTraces(5 * time.Second)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if len(server.traces) != 1 {
+		t.Fatalf("expected 1 trace completion, got %d", len(server.traces))
+	}
+	if server.order[len(server.order)-1] != "trace" {
+		t.Errorf("trace completion was not sent last: %v", server.order)
+	}
+	if len(server.spans) != 4 {
+		t.Errorf("expected 4 spans, got %d", len(server.spans))
+	}
+}
+
+func TestBatching_LocalRootOfRemoteTraceFlushesQueue(t *testing.T) {
+	server := newBatchCaptureServer(t)
+	defer server.Close()
+
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithBatching(BatchOptions{FlushInterval: time.Hour}))
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ExtractTraceContext(context.Background(), h)
+
+	start := time.Now()
+	client.Span(ctx, "downstream", func(ctx context.Context) (any, error) {
+		return client.Span(ctx, "child", func(ctx context.Context) (any, error) {
+			return nil, nil
+		})
+	})
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("local root waited %v for its spans, should not wait for FlushInterval", elapsed)
+	}
+	if got := server.spanCount(); got != 2 {
+		t.Errorf("expected 2 spans delivered when the local root ended, got %d", got)
+	}
+}
+
+func TestBatching_FlushInterval(t *testing.T) {
+	server := newBatchCaptureServer(t)
+	defer server.Close()
+
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithBatching(BatchOptions{FlushInterval: 50 * time.Millisecond}))
+	ctx, root := client.Start(context.Background(), "test", "Root")
+	_, child := client.Start(ctx, "test", "Child")
+	child.End()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for server.spanCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if server.spanCount() != 1 {
+		t.Errorf("expected child span to be sent after FlushInterval, got %d spans", server.spanCount())
+	}
+
+	root.End()
+	client.FlushTraces(5 * time.Second)
+}
+
+func TestBatching_QueueFullDropsSpans(t *testing.T) {
+	h := newHTTPClient("test-key", "http://127.0.0.1:1")
+	// Construct the batcher without starting its worker so the queue fills up.
+	b := &spanBatcher{
+		stats: &h.stats,
+		opts:  BatchOptions{MaxQueueSize: 1}.withDefaults(),
+		queue: make(chan queuedSpan, 1),
+	}
+
+	child := map[string]any{"rawSpan": map[string]any{"parent_id": "p"}}
+	first := b.enqueue(child)
+	second := b.enqueue(child)
+
+	select {
+	case <-second:
+	default:
+		t.Error("dropped span's done channel should be closed immediately")
+	}
+	select {
+	case <-first:
+		t.Error("queued span's done channel should not be closed before delivery")
+	default:
+	}
+}
+
+func TestBatching_UnserializableSpanDoesNotBlockBatch(t *testing.T) {
+	server := newBatchCaptureServer(t)
+	defer server.Close()
+
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithBatching(BatchOptions{FlushInterval: time.Hour}))
+	ctx := context.Background()
+
+	client.Span(ctx, "outer", func(ctx context.Context) (any, error) {
+		client.Span(ctx, "bad", func(ctx context.Context) (any, error) {
+			return map[string]any{"ch": make(chan int)}, nil
+		})
+		return "ok", nil
+	})
+
+	client.FlushTraces(5 * time.Second)
+
+	if got := server.spanCount(); got != 1 {
+		t.Errorf("expected 1 deliverable span, got %d", got)
+	}
+}
@@ -28,11 +28,15 @@
 package bitfab
 
 import (
+	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -40,17 +44,55 @@ import (
 
 // Client is the main entry point for creating spans.
 type Client struct {
-	apiKey       string
-	serviceURL   string
-	enabled      bool
-	httpClient   *httpClient
-	pendingSpans map[string][]<-chan struct{}
-	pendingMu    sync.Mutex
+	apiKey        string
+	serviceURL    string
+	enabled       bool
+	exporter      Exporter
+	batch         *BatchOptions
+	spool         *SpoolOptions
+	retry         RetryPolicy
+	errorStacks   bool
+	pricer        Pricer
+	sampler       Sampler
+	tail          *TailSamplingOptions
+	sanitizer     sanitizer // redaction and payload limits applied before export
+	pendingSpans  map[string][]<-chan struct{}
+	deferred      map[string]*deferredTrace // buffered spans of sampled-on-error and tail-sampled traces, by local root
+	buffered      int                       // spans held in deferred across all traces
+	pendingMu     sync.Mutex
+	live          map[string]*liveTrace // traces whose local root has not finished exporting, by local root
+	idle          *list.List            // local root IDs of evictable live traces, least recently active first
+	traceTTL      time.Duration
+	maxLiveTraces int
+	nextSweep     time.Time
+	evictions     atomic.Int64
+	maxLiveWarned bool          // set once maxLiveTraces was first reached, to log it once
+	closed        bool          // set by Shutdown; no new traces are started
+	drained       chan struct{} // closed when live becomes empty after Shutdown
 }
 
 // Option configures a Client.
 type Option func(*Client)
 
+// WithPricer sets the Pricer used to compute span_data.cost for LLM spans
+// that record a model and token usage but no explicit cost.
+func WithPricer(p Pricer) Option {
+	return func(c *Client) { c.pricer = p }
+}
+
+// WithSampler sets the Sampler that decides which traces are exported.
+// By default every trace is exported.
+func WithSampler(s Sampler) Option {
+	return func(c *Client) { c.sampler = s }
+}
+
+// WithErrorStacks records a stack trace in span_data.error_info whenever an
+// error is set on a span. Stack traces are off by default because capturing
+// them has a cost on every failed span.
+func WithErrorStacks(enabled bool) Option {
+	return func(c *Client) { c.errorStacks = enabled }
+}
+
 // WithServiceURL sets a custom Bitfab API base URL.
 func WithServiceURL(url string) Option {
 	return func(c *Client) { c.serviceURL = url }
@@ -63,6 +105,40 @@ func WithEnabled(enabled bool) Option {
 	return func(c *Client) { c.enabled = enabled }
 }
 
+// WithExporter replaces the default Bitfab HTTP exporter. Spans and trace
+// completions are delivered to e instead of the Bitfab API, and an API key is
+// no longer required to enable tracing.
+func WithExporter(e Exporter) Option {
+	return func(c *Client) { c.exporter = e }
+}
+
+// WithBatching enables queued span delivery for the default HTTP exporter.
+// Instead of one background goroutine per span, spans are buffered in a
+// bounded queue and delivered by a fixed pool of opts.Workers goroutines when
+// MaxBatchSize spans are queued, FlushInterval elapses or a trace's local root
+// span ends. The Bitfab API has no batch endpoint, so each span is still sent
+// in its own request; batching bounds the requests in flight and the memory
+// held by undelivered spans. Zero fields in opts use the package defaults.
+func WithBatching(opts BatchOptions) Option {
+	return func(c *Client) { c.batch = &opts }
+}
+
+// WithSpool enables a durable on-disk spool for the default HTTP exporter.
+// Spans and trace completions that cannot be delivered after retrying are
+// appended to segment files in opts.Dir and replayed by a background drainer
+// once the API is reachable again. A trace completion whose spans were spooled
+// is spooled after them, so the API still receives spans before their trace.
+// Zero fields in opts use the package defaults.
+func WithSpool(opts SpoolOptions) Option {
+	return func(c *Client) { c.spool = &opts }
+}
+
+// WithRetryPolicy sets the retry policy for requests made by the default HTTP
+// exporter. Zero fields in policy use the package defaults.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
 // NewClient creates a new Bitfab client.
 func NewClient(apiKey string, opts ...Option) *Client {
 	c := &Client{
@@ -70,15 +146,25 @@ func NewClient(apiKey string, opts ...Option) *Client {
 		serviceURL:   DefaultServiceURL,
 		enabled:      true,
 		pendingSpans: make(map[string][]<-chan struct{}),
+		deferred:     make(map[string]*deferredTrace),
+		live:         make(map[string]*liveTrace),
+		idle:         list.New(),
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	if c.exporter != nil {
+		return c
+	}
 	if c.enabled && strings.TrimSpace(c.apiKey) == "" {
 		log.Println("Bitfab: apiKey is empty — tracing is disabled. Provide a valid API key to enable tracing.")
 		c.enabled = false
 	}
-	c.httpClient = newHTTPClient(c.apiKey, c.serviceURL)
+	cfg := httpConfig{retry: c.retry}
+	if c.enabled {
+		cfg.batch, cfg.spool = c.batch, c.spool
+	}
+	c.exporter = newHTTPExporter(c.apiKey, c.serviceURL, cfg)
 	return c
 }
 
@@ -89,10 +175,13 @@ type SpanFunc func(ctx context.Context) (any, error)
 type SpanOption func(*spanConfig)
 
 type spanConfig struct {
-	name         string
-	spanType     string
-	functionName string
-	input        any
+	name          string
+	spanType      string
+	functionName  string
+	input         any
+	inputMessages []Message
+	links         []Link
+	llm           llmData
 }
 
 // WithName sets an explicit span name. Defaults to the traceFunctionKey if not set.
@@ -112,6 +201,7 @@ func WithFunctionName(name string) SpanOption {
 }
 
 // WithInput sets the input data recorded in span data for the closure-style Span API.
+// With Start it sets the initial input, which SetInput overwrites.
 // Pass one or more arguments. A single argument is stored directly; multiple arguments
 // are stored as a slice.
 func WithInput(args ...any) SpanOption {
@@ -130,9 +220,13 @@ func WithInput(args ...any) SpanOption {
 //
 // The return value of fn is automatically captured as the span output.
 // Use WithInput to capture input data.
-// If fn returns an error, it is captured in the span data and returned to the caller.
+// If fn returns an error, it is captured in the span data and returned to the caller,
+// and the span status is set to cancelled or timeout when the error comes from
+// context cancellation or a deadline, and to error otherwise.
+// If fn panics, the panic and its stack trace are recorded on the span, the
+// span is sent, and the panic is re-raised.
 func (c *Client) Span(ctx context.Context, traceFunctionKey string, fn SpanFunc, opts ...SpanOption) (any, error) {
-	if !c.enabled {
+	if !c.accepting(ctx) {
 		return fn(ctx)
 	}
 
@@ -148,101 +242,22 @@ func (c *Client) Span(ctx context.Context, traceFunctionKey string, fn SpanFunc,
 		return nil, fmt.Errorf("bitfab: invalid span type %q, must be one of: llm, agent, function, guardrail, handoff, custom", cfg.spanType)
 	}
 
-	parent := currentSpan(ctx)
-	traceID := uuid.New().String()
-	if parent != nil {
-		traceID = parent.traceID
-	}
-	spanID := uuid.New().String()
-
-	var parentSpanID string
-	isRootSpan := parent == nil
-	if parent != nil {
-		parentSpanID = parent.spanID
-	}
-
-	// Register trace state for root spans
-	if isRootSpan && getTraceState(traceID) == nil {
-		createTraceState(traceID)
-		c.pendingMu.Lock()
-		c.pendingSpans[traceID] = []<-chan struct{}{}
-		c.pendingMu.Unlock()
-	}
-
-	startedAt := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
-
 	// Execute fn with the new span pushed onto the context stack
-	childCtx := withSpanContext(ctx, traceID, spanID)
-	result, fnErr := fn(childCtx)
-
-	endedAt := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
-
-	// Build and send span data — wrapped in a closure so a panic here
-	// never crashes the host app. The user's result/error is always returned.
-	func() {
-		defer func() { recover() }()
-
-		spanData := map[string]any{
-			"name": cfg.name,
-			"type": cfg.spanType,
-		}
-		if cfg.functionName != "" {
-			spanData["function_name"] = cfg.functionName
-		}
-		if cfg.input != nil {
-			spanData["input"] = cfg.input
-		}
-		if result != nil {
-			spanData["output"] = result
-		}
-		if fnErr != nil {
-			spanData["error"] = fnErr.Error()
-		}
-
-		rawSpan := map[string]any{
-			"id":         spanID,
-			"trace_id":   traceID,
-			"started_at": startedAt,
-			"ended_at":   endedAt,
-			"span_data":  spanData,
-		}
-		if parentSpanID != "" {
-			rawSpan["parent_id"] = parentSpanID
-		}
-
-		done := c.httpClient.sendExternalSpan(map[string]any{
-			"type":             "sdk-function",
-			"source":           "go-sdk-function",
-			"sourceTraceId":    traceID,
-			"traceFunctionKey": traceFunctionKey,
-			"rawSpan":          rawSpan,
-		})
-
-		if isRootSpan {
-			c.pendingMu.Lock()
-			pending := c.pendingSpans[traceID]
-			delete(c.pendingSpans, traceID)
-			c.pendingMu.Unlock()
-
-			for _, ch := range pending {
-				select {
-				case <-ch:
-				case <-time.After(5 * time.Second):
-				}
-			}
-
-			select {
-			case <-done:
-			case <-time.After(5 * time.Second):
-			}
-
-			c.sendTraceCompletion(traceFunctionKey, traceID, startedAt, endedAt)
-		} else {
-			c.pendingMu.Lock()
-			c.pendingSpans[traceID] = append(c.pendingSpans[traceID], done)
-			c.pendingMu.Unlock()
+	childCtx, span := c.start(ctx, traceFunctionKey, cfg)
+	defer func() {
+		if r := recover(); r != nil {
+			// Send the span and trace completion, then let the panic continue.
+			span.RecordPanic(r)
+			span.End()
+			panic(r)
 		}
 	}()
+	result, fnErr := fn(childCtx)
+
+	// End never panics, so the user's result/error is always returned.
+	span.SetOutput(result)
+	span.SetError(fnErr)
+	span.End()
 
 	return result, fnErr
 }
@@ -253,7 +268,7 @@ func (c *Client) Span(ctx context.Context, traceFunctionKey string, fn SpanFunc,
 //
 // This is the recommended way to instrument existing functions without restructuring them.
 func (c *Client) Start(ctx context.Context, traceFunctionKey string, spanName string, opts ...SpanOption) (context.Context, *ActiveSpan) {
-	if !c.enabled {
+	if !c.accepting(ctx) {
 		return ctx, &ActiveSpan{}
 	}
 
@@ -265,6 +280,18 @@ func (c *Client) Start(ctx context.Context, traceFunctionKey string, spanName st
 		opt(&cfg)
 	}
 
+	return c.start(ctx, traceFunctionKey, cfg)
+}
+
+// start creates a span as a child of the current span in ctx, or as a new
+// trace if there is none, and pushes it onto the context's span stack.
+//
+// The first span of a trace in this process is its local root: it tracks the
+// deliveries of its descendants and waits for them when it ends. A local root
+// whose parent was extracted from a request sent by this SDK continues a trace
+// owned by another service and does not send the trace completion; one whose
+// parent came from any other caller sends it, since no one else will.
+func (c *Client) start(ctx context.Context, traceFunctionKey string, cfg spanConfig) (context.Context, *ActiveSpan) {
 	parent := currentSpan(ctx)
 	traceID := uuid.New().String()
 	if parent != nil {
@@ -273,20 +300,36 @@ func (c *Client) Start(ctx context.Context, traceFunctionKey string, spanName st
 	spanID := uuid.New().String()
 
 	var parentSpanID string
-	isRootSpan := parent == nil
+	isRootSpan := parent == nil || parent.foreign()
 	if parent != nil {
 		parentSpanID = parent.spanID
 	}
+	localRootID := spanID
+	if parent != nil && !parent.remote {
+		localRootID = parent.localRootID
+	}
 
-	// Register trace state for root spans
-	if isRootSpan && getTraceState(traceID) == nil {
-		createTraceState(traceID)
-		c.pendingMu.Lock()
-		c.pendingSpans[traceID] = []<-chan struct{}{}
-		c.pendingMu.Unlock()
+	// The sampling decision is made once per trace and inherited by children.
+	var sampling SamplingDecision
+	if parent != nil && !parent.foreign() {
+		sampling = parent.sampling
+	} else {
+		sampling = c.sample(SamplingParameters{
+			TraceID:          traceID,
+			TraceFunctionKey: traceFunctionKey,
+			SpanName:         cfg.name,
+			SpanType:         cfg.spanType,
+		})
 	}
 
-	childCtx := withSpanContext(ctx, traceID, spanID)
+	// Register trace state for local root spans
+	if localRootID == spanID {
+		c.registerTrace(traceID, localRootID, sampling)
+	} else {
+		c.touch(localRootID)
+	}
+
+	now := time.Now()
 
 	span := &ActiveSpan{
 		client:           c,
@@ -294,10 +337,18 @@ func (c *Client) Start(ctx context.Context, traceFunctionKey string, spanName st
 		traceID:          traceID,
 		spanID:           spanID,
 		parentSpanID:     parentSpanID,
-		startedAt:        time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		localRootID:      localRootID,
+		startedAt:        now.UTC().Format("2006-01-02T15:04:05.000Z"),
+		start:            now,
 		cfg:              cfg,
+		input:            cfg.input,
+		inputMessages:    cfg.inputMessages,
+		links:            cfg.links,
+		llm:              cfg.llm,
 		isRootSpan:       isRootSpan,
+		sampling:         sampling,
 	}
+	childCtx := pushSpan(ctx, spanEntry{traceID: traceID, spanID: spanID, localRootID: localRootID, sampling: sampling, span: span})
 
 	return childCtx, span
 }
@@ -305,7 +356,69 @@ func (c *Client) Start(ctx context.Context, traceFunctionKey string, spanName st
 // FlushTraces waits for all pending background span deliveries to complete,
 // up to the given timeout.
 func (c *Client) FlushTraces(timeout time.Duration) {
-	c.httpClient.flush(timeout)
+	c.exporter.Flush(timeout)
+}
+
+// Shutdown stops the client from starting new traces, waits for open traces
+// to finish (including their root span's trace completion), and then shuts
+// down the exporter. Spans started in ctx after Shutdown still run their
+// callbacks but are not traced, except children of traces that are still open
+// in this process.
+//
+// If ctx is done before everything was delivered, or deliveries failed,
+// Shutdown returns a *ShutdownError with the number of spans and traces that
+// were lost. Calling Shutdown more than once is a no-op.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.pendingMu.Lock()
+	if c.closed {
+		c.pendingMu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.drained = make(chan struct{})
+	c.checkDrainedLocked()
+	c.pendingMu.Unlock()
+
+	var abandoned int
+	select {
+	case <-c.drained:
+	case <-ctx.Done():
+		c.pendingMu.Lock()
+		abandoned = len(c.live)
+		c.pendingMu.Unlock()
+	}
+
+	err := c.exporter.Shutdown(ctx)
+	if err == nil && abandoned == 0 {
+		return nil
+	}
+	var se *ShutdownError
+	if !errors.As(err, &se) {
+		se = &ShutdownError{Err: err}
+	}
+	se.DroppedTraces += abandoned
+	if se.Err == nil && abandoned > 0 {
+		se.Err = ctx.Err()
+	}
+	return se
+}
+
+// accepting reports whether a span may be started in ctx. After Shutdown,
+// only children of traces that are still open in this process are accepted;
+// a remote parent extracted from an incoming request would start a new
+// local trace.
+func (c *Client) accepting(ctx context.Context) bool {
+	if !c.enabled {
+		return false
+	}
+	c.pendingMu.Lock()
+	closed := c.closed
+	c.pendingMu.Unlock()
+	if !closed {
+		return true
+	}
+	parent := currentSpan(ctx)
+	return parent != nil && !parent.remote
 }
 
 // GetFunction returns a Function bound to the given traceFunctionKey.
@@ -336,20 +449,35 @@ func (f *Function) Start(ctx context.Context, spanName string, opts ...SpanOptio
 // ActiveSpan represents an in-progress span created by Start.
 // Call End() to complete the span and send it to the API.
 type ActiveSpan struct {
-	client           *Client
-	traceFunctionKey string
-	traceID          string
-	spanID           string
-	parentSpanID     string
-	startedAt        string
-	cfg              spanConfig
-	input            any
-	output           any
-	spanErr          error
-	contexts         []ContextEntry
-	prompt           string
-	isRootSpan       bool
-	once             sync.Once
+	client            *Client
+	traceFunctionKey  string
+	traceID           string
+	spanID            string
+	parentSpanID      string
+	localRootID       string
+	startedAt         string
+	start             time.Time
+	cfg               spanConfig
+	input             any
+	output            any
+	spanErr           error
+	status            StatusCode
+	statusDescription string
+	errorStack        string
+	contexts          []ContextEntry
+	prompt            string
+	inputMessages     []Message
+	outputMessages    []Message
+	llm               llmData
+	stream            streamState
+	mu                sync.Mutex // guards events and links, which may be added concurrently
+	events            []SpanEvent
+	links             []Link
+	panicValue        any
+	panicStack        string
+	isRootSpan        bool
+	sampling          SamplingDecision
+	once              sync.Once
 }
 
 // SetInput records the span's input data. Pass one or more arguments.
@@ -377,7 +505,9 @@ func (s *ActiveSpan) SetOutput(output any) {
 	s.output = output
 }
 
-// SetError records an error on the span.
+// SetError records an error on the span. Besides the error message, the span
+// records the error's Go type, its wrapped chain and any ErrorAttributer
+// fields, plus a stack trace when the client was created with WithErrorStacks.
 // Safe to call on nil receiver (no-op).
 func (s *ActiveSpan) SetError(err error) {
 	defer func() { recover() }()
@@ -385,6 +515,10 @@ func (s *ActiveSpan) SetError(err error) {
 		return
 	}
 	s.spanErr = err
+	s.errorStack = ""
+	if err != nil && s.client != nil && s.client.errorStacks {
+		s.errorStack = callerStack(1)
+	}
 }
 
 // AddContext adds a context entry to the span.
@@ -411,6 +545,33 @@ func (s *ActiveSpan) SetPrompt(prompt string) {
 	s.prompt = prompt
 }
 
+// RecordPanic records a recovered panic value on the span together with the
+// current stack trace, and marks the span as failed. Call it from a deferred
+// recover block, then End the span and re-panic if the panic should continue:
+//
+//	defer func() {
+//	    if r := recover(); r != nil {
+//	        span.RecordPanic(r)
+//	        span.End()
+//	        panic(r)
+//	    }
+//	}()
+//
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) RecordPanic(r any) {
+	defer func() { recover() }()
+	if s == nil || r == nil {
+		return
+	}
+	s.panicValue = r
+	s.panicStack = string(debug.Stack())
+	if err, ok := r.(error); ok {
+		s.spanErr = fmt.Errorf("panic: %w", err)
+	} else {
+		s.spanErr = fmt.Errorf("panic: %v", r)
+	}
+}
+
 // End completes the span and sends it to the API in the background.
 // End is idempotent — calling it multiple times has no effect after the first call.
 func (s *ActiveSpan) End() {
@@ -421,12 +582,25 @@ func (s *ActiveSpan) End() {
 	s.once.Do(func() {
 		defer func() { recover() }() // Never crash the host app
 
-		endedAt := time.Now().UTC().Format("2006-01-02T15:04:05.000Z")
+		if s.sampling == DecisionDrop {
+			// Nothing of a dropped trace is exported, so the span is not
+			// built; its local root only releases the trace state.
+			if s.localRootID == s.spanID {
+				s.client.dropTrace(s.spanID)
+			}
+			return
+		}
+
+		now := time.Now()
+		endedAt := now.UTC().Format("2006-01-02T15:04:05.000Z")
 
 		spanData := map[string]any{
 			"name": s.cfg.name,
 			"type": s.cfg.spanType,
 		}
+		if streamed := s.stream.apply(spanData, s.start, now, s.llm.usage); streamed != "" && s.output == nil {
+			s.output = streamed
+		}
 		if s.cfg.functionName != "" {
 			spanData["function_name"] = s.cfg.functionName
 		}
@@ -436,15 +610,42 @@ func (s *ActiveSpan) End() {
 		if s.output != nil {
 			spanData["output"] = s.output
 		}
+		status := spanStatus(s.status, s.statusDescription, s.spanErr)
+		spanData["status"] = status
 		if s.spanErr != nil {
 			spanData["error"] = s.spanErr.Error()
+			spanData["error_info"] = errorInfo(s.spanErr, s.errorStack)
+		}
+		if s.panicValue != nil {
+			spanData["panic"] = map[string]any{
+				"value": fmt.Sprint(s.panicValue),
+				"stack": s.panicStack,
+			}
+		}
+		s.mu.Lock()
+		if len(s.events) > 0 {
+			spanData["events"] = s.events
 		}
+		s.mu.Unlock()
 		if len(s.contexts) > 0 {
 			spanData["contexts"] = s.contexts
 		}
 		if s.prompt != "" {
 			spanData["prompt"] = s.prompt
 		}
+		if len(s.inputMessages) > 0 {
+			spanData["input_messages"] = s.inputMessages
+		}
+		if len(s.outputMessages) > 0 {
+			spanData["output_messages"] = s.outputMessages
+		}
+		s.llm.apply(spanData, s.client.pricer)
+		s.mu.Lock()
+		links := s.links
+		s.mu.Unlock()
+		if s.client.sanitizer.enabled() {
+			links = s.client.sanitizer.sanitizeSpanData(spanData, links)
+		}
 
 		rawSpan := map[string]any{
 			"id":         s.spanID,
@@ -456,65 +657,201 @@ func (s *ActiveSpan) End() {
 		if s.parentSpanID != "" {
 			rawSpan["parent_id"] = s.parentSpanID
 		}
+		if len(links) > 0 {
+			rawSpan["links"] = links
+		}
 
-		done := s.client.httpClient.sendExternalSpan(map[string]any{
-			"type":             "sdk-function",
-			"source":           "go-sdk-function",
-			"sourceTraceId":    s.traceID,
-			"traceFunctionKey": s.traceFunctionKey,
-			"rawSpan":          rawSpan,
-		})
+		s.export(rawSpan, endedAt, isFailure(StatusCode(status["code"].(string))))
+	})
+}
+
+// export hands the finished span to the exporter according to the trace's
+// sampling decision. A local root first waits for its descendants to be
+// delivered; if it is also the trace's true root and the trace was sampled,
+// it then sends the trace completion.
+func (s *ActiveSpan) export(rawSpan map[string]any, endedAt string, failed bool) {
+	c := s.client
+	payload := map[string]any{
+		"type":             "sdk-function",
+		"source":           "go-sdk-function",
+		"sourceTraceId":    s.traceID,
+		"traceFunctionKey": s.traceFunctionKey,
+		"rawSpan":          rawSpan,
+	}
 
-		if s.isRootSpan {
-			s.client.pendingMu.Lock()
-			pending := s.client.pendingSpans[s.traceID]
-			delete(s.client.pendingSpans, s.traceID)
-			s.client.pendingMu.Unlock()
-
-			for _, ch := range pending {
-				select {
-				case <-ch:
-				case <-time.After(5 * time.Second):
-				}
+	var done <-chan struct{}
+	if c.buffers(s.sampling) {
+		c.deferSpan(s.localRootID, payload, failed)
+	} else if s.sampling == DecisionSample {
+		done = c.exporter.ExportSpan(payload)
+	}
+
+	if s.localRootID != s.spanID {
+		if done != nil {
+			c.pendingMu.Lock()
+			// Spans ending after their local root, or after their trace was
+			// evicted, have no one waiting for them.
+			if pending, ok := c.pendingSpans[s.localRootID]; ok {
+				c.pendingSpans[s.localRootID] = append(pending, done)
 			}
+			c.pendingMu.Unlock()
+		}
+		return
+	}
 
-			select {
-			case <-done:
-			case <-time.After(5 * time.Second):
+	c.pendingMu.Lock()
+	lt := c.live[s.spanID]
+	if lt == nil {
+		// The trace was evicted as abandoned and its state is gone.
+		c.pendingMu.Unlock()
+		return
+	}
+	c.endingLocked(lt)
+	defer c.finishTrace(s.spanID)
+	pending := c.pendingSpans[s.spanID]
+	delete(c.pendingSpans, s.spanID)
+	deferred := c.deferred[s.spanID]
+	delete(c.deferred, s.spanID)
+	if deferred != nil {
+		c.buffered -= len(deferred.payloads)
+	}
+	c.pendingMu.Unlock()
+
+	sampled := s.sampling == DecisionSample
+	if deferred != nil {
+		sampled = c.keepDeferred(s, deferred, lt.state)
+		if sampled {
+			for _, p := range deferred.payloads {
+				pending = append(pending, c.exporter.ExportSpan(p))
 			}
+		}
+	}
+	if done != nil {
+		pending = append(pending, done)
+	}
+	if f, ok := c.exporter.(queueFlusher); ok && len(pending) > 0 {
+		// The trace's spans are all exported; send them now rather than
+		// waiting for the exporter's flush interval.
+		f.flushQueue()
+	}
 
-			s.client.sendTraceCompletion(s.traceFunctionKey, s.traceID, s.startedAt, endedAt)
-		} else {
-			s.client.pendingMu.Lock()
-			s.client.pendingSpans[s.traceID] = append(s.client.pendingSpans[s.traceID], done)
-			s.client.pendingMu.Unlock()
+	for _, ch := range pending {
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
 		}
-	})
+	}
+
+	if !s.isRootSpan || !sampled {
+		// Either another service instrumented with this SDK owns the trace and
+		// sends its completion, or nothing of it was exported.
+		return
+	}
+	c.sendTraceCompletion(s.traceFunctionKey, lt.state, s.startedAt, endedAt)
+}
+
+// registerTrace creates the trace state for a new local root span and starts
+// tracking the deliveries of its descendants.
+func (c *Client) registerTrace(traceID, localRootID string, sampling SamplingDecision) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	now := time.Now()
+	c.sweepLocked(now)
+	c.addLiveLocked(localRootID, &liveTrace{traceID: traceID, state: newTraceState(traceID), lastActive: now})
+	c.pendingSpans[localRootID] = []<-chan struct{}{}
+	if c.buffers(sampling) {
+		c.deferred[localRootID] = &deferredTrace{}
+	}
+}
+
+// deferSpan buffers a span until its local root ends and the trace's
+// sampling is decided. Spans ending after their local root, or while the
+// buffer limits are reached, are dropped.
+func (c *Client) deferSpan(localRootID string, payload map[string]any, failed bool) {
+	perTrace, total := DefaultMaxSpansPerTrace, DefaultMaxBufferedSpans
+	if c.tail != nil {
+		perTrace, total = c.tail.MaxSpansPerTrace, c.tail.MaxBufferedSpans
+	}
+
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	d := c.deferred[localRootID]
+	if d == nil {
+		return
+	}
+	d.failed = d.failed || failed
+	if len(d.payloads) < perTrace && c.buffered < total {
+		d.payloads = append(d.payloads, payload)
+		c.buffered++
+	}
+}
+
+// traceState returns the state of the open trace with the given local root,
+// or nil if it has finished or was evicted.
+func (c *Client) traceState(localRootID string) *TraceState {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	if lt := c.live[localRootID]; lt != nil {
+		return lt.state
+	}
+	return nil
+}
+
+// finishTrace marks the trace of a local root as completed. Once Shutdown
+// has been called, the last trace to finish unblocks it.
+func (c *Client) finishTrace(localRootID string) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	c.removeLiveLocked(localRootID)
+	c.checkDrainedLocked()
+}
+
+// dropTrace releases the state of a dropped trace when its local root ends.
+func (c *Client) dropTrace(localRootID string) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	delete(c.pendingSpans, localRootID)
+	c.removeLiveLocked(localRootID)
+	c.checkDrainedLocked()
+}
+
+// checkDrainedLocked unblocks Shutdown once no traces are open.
+// c.pendingMu must be held.
+func (c *Client) checkDrainedLocked() {
+	if c.closed && len(c.live) == 0 {
+		select {
+		case <-c.drained:
+		default:
+			close(c.drained)
+		}
+	}
 }
 
 // sendTraceCompletion sends trace completion data to the API.
-func (c *Client) sendTraceCompletion(traceFunctionKey, traceID, startedAt, endedAt string) {
+func (c *Client) sendTraceCompletion(traceFunctionKey string, ts *TraceState, startedAt, endedAt string) {
 	defer func() { recover() }() // Never crash the host app
 
-	ts := getTraceState(traceID)
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
 	traceStartedAt := startedAt
-	if ts != nil && ts.StartedAt != "" {
+	if ts.StartedAt != "" {
 		traceStartedAt = ts.StartedAt
 	}
 
 	rawTrace := map[string]any{
-		"id":         traceID,
+		"id":         ts.TraceID,
 		"started_at": traceStartedAt,
 		"ended_at":   endedAt,
 	}
-
-	if ts != nil {
-		if ts.Metadata != nil {
-			rawTrace["metadata"] = ts.Metadata
-		}
-		if len(ts.Contexts) > 0 {
-			rawTrace["contexts"] = ts.Contexts
-		}
+	if ts.Metadata != nil {
+		rawTrace["metadata"] = ts.Metadata
+	}
+	if len(ts.Contexts) > 0 {
+		rawTrace["contexts"] = ts.Contexts
+	}
+	if c.sanitizer.enabled() {
+		c.sanitizer.sanitizeTraceData(rawTrace)
 	}
 
 	payload := map[string]any{
@@ -525,12 +862,9 @@ func (c *Client) sendTraceCompletion(traceFunctionKey, traceID, startedAt, ended
 		"completed":        true,
 	}
 
-	if ts != nil && ts.SessionID != "" {
+	if ts.SessionID != "" {
 		payload["sessionId"] = ts.SessionID
 	}
 
-	c.httpClient.sendExternalTrace(payload)
-
-	// Clean up trace state
-	deleteTraceState(traceID)
+	c.exporter.ExportTrace(payload)
 }
@@ -1127,7 +1127,7 @@ func TestGetCurrentTrace_InsideSpan(t *testing.T) {
 }
 
 func TestTraceCompletion_SessionID(t *testing.T) {
-	clearAllTraceStates()
+	t.Parallel()
 	var mu sync.Mutex
 	var tracePayload map[string]any
 
@@ -1168,7 +1168,7 @@ func TestTraceCompletion_SessionID(t *testing.T) {
 }
 
 func TestTraceCompletion_Metadata(t *testing.T) {
-	clearAllTraceStates()
+	t.Parallel()
 	var mu sync.Mutex
 	var tracePayload map[string]any
 
@@ -1213,7 +1213,7 @@ func TestTraceCompletion_Metadata(t *testing.T) {
 }
 
 func TestTraceCompletion_Contexts(t *testing.T) {
-	clearAllTraceStates()
+	t.Parallel()
 	var mu sync.Mutex
 	var tracePayload map[string]any
 
@@ -1263,7 +1263,7 @@ func TestTraceCompletion_Contexts(t *testing.T) {
 }
 
 func TestTraceCompletion_AllMethods(t *testing.T) {
-	clearAllTraceStates()
+	t.Parallel()
 	var mu sync.Mutex
 	var tracePayload map[string]any
 
@@ -1314,7 +1314,7 @@ func TestTraceCompletion_AllMethods(t *testing.T) {
 }
 
 func TestTraceCompletion_OnlyForRootSpans(t *testing.T) {
-	clearAllTraceStates()
+	t.Parallel()
 	var mu sync.Mutex
 	var spanCount, traceCount int
 
@@ -1355,7 +1355,7 @@ func TestTraceCompletion_OnlyForRootSpans(t *testing.T) {
 }
 
 func TestTraceCompletion_HasEndedAt(t *testing.T) {
-	clearAllTraceStates()
+	t.Parallel()
 	var mu sync.Mutex
 	var tracePayload map[string]any
 
@@ -1544,3 +1544,220 @@ func TestSetPrompt_EmptyStringIgnored(t *testing.T) {
 		t.Error("prompt should not be present when SetPrompt was called with empty string")
 	}
 }
+
+func TestShutdown_DrainsQueuedSpans(t *testing.T) {
+	server := newBatchCaptureServer(t)
+	defer server.Close()
+
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithBatching(BatchOptions{FlushInterval: time.Hour}))
+	ctx := context.Background()
+
+	client.Span(ctx, "outer", func(ctx context.Context) (any, error) {
+		return client.Span(ctx, "inner", func(ctx context.Context) (any, error) {
+			return "inner-result", nil
+		})
+	})
+
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if got := len(server.spans); got != 2 {
+		t.Errorf("expected 2 spans, got %d", got)
+	}
+	if got := len(server.traces); got != 1 {
+		t.Errorf("expected 1 trace completion, got %d", got)
+	}
+}
+
+func TestShutdown_RejectsNewSpans(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	result, err := client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		return "still-runs", nil
+	})
+	if err != nil || result != "still-runs" {
+		t.Errorf("Span after Shutdown = (%v, %v), want (still-runs, nil)", result, err)
+	}
+	_, span := client.Start(context.Background(), "test", "Test")
+	span.End()
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if len(exp.spans) != 0 {
+		t.Errorf("exported %d spans after Shutdown, want 0", len(exp.spans))
+	}
+	if !exp.shutdown {
+		t.Error("exporter was not shut down")
+	}
+}
+
+func TestShutdown_WaitsForOpenTraces(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	ctx, root := client.Start(context.Background(), "test", "Root")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		// Children of a trace that is still open are accepted during shutdown.
+		_, child := client.Start(ctx, "test", "Child")
+		child.End()
+		root.End()
+	}()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if len(exp.spans) != 2 {
+		t.Errorf("expected 2 spans, got %d", len(exp.spans))
+	}
+	if len(exp.traces) != 1 {
+		t.Errorf("expected 1 trace completion, got %d", len(exp.traces))
+	}
+}
+
+func TestShutdown_ReportsAbandonedTraces(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	client.Start(context.Background(), "test", "NeverEnded")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.Shutdown(ctx)
+
+	var se *ShutdownError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *ShutdownError, got %v", err)
+	}
+	if se.DroppedTraces != 1 {
+		t.Errorf("DroppedTraces = %d, want 1", se.DroppedTraces)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error should wrap context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestShutdown_ReportsFailedDeliveries(t *testing.T) {
+	client := NewClient("test-key", WithServiceURL("http://127.0.0.1:1"),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		return "done", nil
+	})
+
+	err := client.Shutdown(context.Background())
+	var se *ShutdownError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *ShutdownError, got %v", err)
+	}
+	if se.DroppedSpans != 1 || se.DroppedTraces != 1 {
+		t.Errorf("dropped = %d spans, %d traces; want 1 and 1", se.DroppedSpans, se.DroppedTraces)
+	}
+}
+
+func TestShutdown_Idempotent(t *testing.T) {
+	client := NewClient("test-key", WithExporter(&recordingExporter{}))
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("first Shutdown returned error: %v", err)
+	}
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("second Shutdown returned error: %v", err)
+	}
+}
+
+func TestSpan_PanicIsRecordedAndReraised(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	var traceID string
+	func() {
+		defer func() {
+			if r := recover(); r != "kaboom" {
+				t.Errorf("recovered %v, want the original panic value", r)
+			}
+		}()
+		client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+			traceID = GetCurrentTrace(ctx).traceID
+			client.Span(ctx, "test", func(ctx context.Context) (any, error) {
+				panic("kaboom")
+			}, WithName("Inner"))
+			return nil, nil
+		}, WithName("Outer"))
+	}()
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if len(exp.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(exp.spans))
+	}
+	for i, name := range []string{"Inner", "Outer"} {
+		spanData := exp.spans[i]["rawSpan"].(map[string]any)["span_data"].(map[string]any)
+		if spanData["name"] != name {
+			t.Errorf("span %d name = %v, want %s", i, spanData["name"], name)
+		}
+		if spanData["error"] != "panic: kaboom" {
+			t.Errorf("span %s error = %v, want 'panic: kaboom'", name, spanData["error"])
+		}
+		p, ok := spanData["panic"].(map[string]any)
+		if !ok || p["value"] != "kaboom" {
+			t.Fatalf("span %s panic = %v", name, spanData["panic"])
+		}
+		if !strings.Contains(p["stack"].(string), "TestSpan_PanicIsRecordedAndReraised") {
+			t.Errorf("span %s stack should include the panicking function:\n%s", name, p["stack"])
+		}
+	}
+	if len(exp.traces) != 1 {
+		t.Errorf("sent %d trace completions, want 1", len(exp.traces))
+	}
+	if traceStateOf(client, traceID) != nil {
+		t.Error("trace state should be cleaned up after a panic")
+	}
+	client.pendingMu.Lock()
+	defer client.pendingMu.Unlock()
+	if len(client.pendingSpans) != 0 || len(client.live) != 0 {
+		t.Errorf("pending spans = %d, live traces = %d, want none", len(client.pendingSpans), len(client.live))
+	}
+}
+
+func TestActiveSpan_RecordPanic(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	func() {
+		defer func() { recover() }()
+		_, span := client.Start(context.Background(), "test", "Work")
+		defer func() {
+			if r := recover(); r != nil {
+				span.RecordPanic(r)
+				span.End()
+				panic(r)
+			}
+		}()
+		panic(errors.New("bad state"))
+	}()
+
+	spanData := exp.spanData(0)
+	if spanData["error"] != "panic: bad state" {
+		t.Errorf("error = %v, want 'panic: bad state'", spanData["error"])
+	}
+	if p, ok := spanData["panic"].(map[string]any); !ok || p["value"] != "bad state" || p["stack"] == "" {
+		t.Errorf("panic = %v", spanData["panic"])
+	}
+
+	var nilSpan *ActiveSpan
+	nilSpan.RecordPanic("ignored")
+}
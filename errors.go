@@ -0,0 +1,99 @@
+package bitfab
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// maxErrorChain caps the number of errors recorded from a wrapped error tree,
+// guarding against very deep or cyclic Unwrap implementations.
+const maxErrorChain = 32
+
+// ErrorAttributer can be implemented by domain errors to attach structured
+// fields, such as an error code or whether the operation is retryable, to the
+// span's error info:
+//
+//	func (e *QuotaError) ErrorAttributes() map[string]any {
+//	    return map[string]any{"code": e.Code, "retryable": true}
+//	}
+//
+// Attributes from every error in the wrapped chain are merged; errors closer
+// to the top of the chain take precedence.
+type ErrorAttributer interface {
+	ErrorAttributes() map[string]any
+}
+
+// errorInfo builds the structured error recorded in span_data.error_info: the
+// concrete Go type and message of err, every error reachable through Unwrap
+// (including errors.Join trees, depth first), merged ErrorAttributer fields,
+// and the stack trace if one was captured.
+func errorInfo(err error, stack string) map[string]any {
+	info := map[string]any{
+		"type":    fmt.Sprintf("%T", err),
+		"message": err.Error(),
+	}
+
+	var chain []map[string]any
+	attrs := map[string]any{}
+	var walk func(e error)
+	walk = func(e error) {
+		if e == nil || len(chain) >= maxErrorChain {
+			return
+		}
+		entry := map[string]any{
+			"type":    fmt.Sprintf("%T", e),
+			"message": e.Error(),
+		}
+		if a, ok := e.(ErrorAttributer); ok {
+			if fields := a.ErrorAttributes(); len(fields) > 0 {
+				entry["attributes"] = fields
+				for k, v := range fields {
+					if _, exists := attrs[k]; !exists {
+						attrs[k] = v
+					}
+				}
+			}
+		}
+		chain = append(chain, entry)
+
+		switch u := e.(type) {
+		case interface{ Unwrap() error }:
+			walk(u.Unwrap())
+		case interface{ Unwrap() []error }:
+			for _, inner := range u.Unwrap() {
+				walk(inner)
+			}
+		}
+	}
+	walk(err)
+
+	if len(chain) > 1 {
+		info["chain"] = chain
+	}
+	if len(attrs) > 0 {
+		info["attributes"] = attrs
+	}
+	if stack != "" {
+		info["stack"] = stack
+	}
+	return info
+}
+
+// callerStack formats the stack of the goroutine calling it, skipping skip
+// frames above the caller, in the same layout as runtime/debug.Stack.
+func callerStack(skip int) string {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,158 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+type quotaError struct {
+	limit int
+}
+
+func (e *quotaError) Error() string { return fmt.Sprintf("quota of %d exceeded", e.limit) }
+
+func (e *quotaError) ErrorAttributes() map[string]any {
+	return map[string]any{"code": "QUOTA_EXCEEDED", "retryable": true}
+}
+
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string { return "request failed: " + e.err.Error() }
+func (e *requestError) Unwrap() error { return e.err }
+
+func (e *requestError) ErrorAttributes() map[string]any {
+	return map[string]any{"code": "REQUEST_FAILED"}
+}
+
+func TestErrorInfo_TypeAndMessage(t *testing.T) {
+	_, err := os.Open("/does/not/exist")
+	info := errorInfo(err, "")
+
+	if info["type"] != "*fs.PathError" {
+		t.Errorf("type = %v, want *fs.PathError", info["type"])
+	}
+	if info["message"] != err.Error() {
+		t.Errorf("message = %v, want %q", info["message"], err.Error())
+	}
+	chain := info["chain"].([]map[string]any)
+	if len(chain) != 2 || chain[1]["type"] != "syscall.Errno" {
+		t.Errorf("chain = %v, want PathError wrapping syscall.Errno", chain)
+	}
+	if _, ok := info["stack"]; ok {
+		t.Error("stack should be omitted when none was captured")
+	}
+}
+
+func TestErrorInfo_SingleErrorHasNoChain(t *testing.T) {
+	info := errorInfo(errors.New("plain"), "")
+	if _, ok := info["chain"]; ok {
+		t.Errorf("chain = %v, want omitted for an unwrapped error", info["chain"])
+	}
+}
+
+func TestErrorInfo_JoinAndWrap(t *testing.T) {
+	err := fmt.Errorf("save: %w", errors.Join(fs.ErrNotExist, &quotaError{limit: 10}))
+	info := errorInfo(err, "")
+
+	var types []string
+	for _, e := range info["chain"].([]map[string]any) {
+		types = append(types, e["type"].(string))
+	}
+	want := []string{"*fmt.wrapError", "*errors.joinError", "*errors.errorString", "*bitfab.quotaError"}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("chain types = %v, want %v", types, want)
+	}
+	if attrs := info["attributes"].(map[string]any); attrs["code"] != "QUOTA_EXCEEDED" {
+		t.Errorf("attributes = %v", attrs)
+	}
+}
+
+func TestErrorInfo_OuterAttributesTakePrecedence(t *testing.T) {
+	err := &requestError{err: &quotaError{limit: 5}}
+	attrs := errorInfo(err, "")["attributes"].(map[string]any)
+
+	if attrs["code"] != "REQUEST_FAILED" {
+		t.Errorf("code = %v, want the outer error's code", attrs["code"])
+	}
+	if attrs["retryable"] != true {
+		t.Errorf("retryable = %v, want inner attribute to be merged", attrs["retryable"])
+	}
+}
+
+func TestSetError_RecordsErrorInfo(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		return nil, fmt.Errorf("charge: %w", &quotaError{limit: 3})
+	})
+
+	spanData := exp.spanData(0)
+	if spanData["error"] != "charge: quota of 3 exceeded" {
+		t.Errorf("error = %v, want the message string", spanData["error"])
+	}
+	info, ok := spanData["error_info"].(map[string]any)
+	if !ok {
+		t.Fatalf("error_info = %v", spanData["error_info"])
+	}
+	if info["type"] != "*fmt.wrapError" {
+		t.Errorf("type = %v", info["type"])
+	}
+	if _, ok := info["stack"]; ok {
+		t.Error("stack should not be captured without WithErrorStacks")
+	}
+}
+
+func TestSetError_WithErrorStacks(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithErrorStacks(true))
+
+	_, span := client.Start(context.Background(), "test", "Work")
+	span.SetError(errors.New("failed"))
+	span.End()
+
+	info := exp.spanData(0)["error_info"].(map[string]any)
+	stack, _ := info["stack"].(string)
+	if !strings.Contains(stack, "TestSetError_WithErrorStacks") {
+		t.Errorf("stack should start at the SetError caller:\n%s", stack)
+	}
+	if strings.Contains(stack, "callerStack") {
+		t.Errorf("stack should not include SDK internals:\n%s", stack)
+	}
+}
+
+func TestSetError_NilClearsErrorInfo(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "test", "Work")
+	span.SetError(errors.New("transient"))
+	span.SetError(nil)
+	span.End()
+
+	spanData := exp.spanData(0)
+	if _, ok := spanData["error_info"]; ok {
+		t.Errorf("error_info = %v, want omitted after clearing the error", spanData["error_info"])
+	}
+}
+
+func TestRecordPanic_ErrorValueIsInChain(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "test", "Work")
+	span.RecordPanic(&quotaError{limit: 1})
+	span.End()
+
+	info := exp.spanData(0)["error_info"].(map[string]any)
+	if attrs, _ := info["attributes"].(map[string]any); attrs["code"] != "QUOTA_EXCEEDED" {
+		t.Errorf("panicked error's attributes should be recorded, got %v", info)
+	}
+}
@@ -0,0 +1,30 @@
+package bitfab
+
+import "time"
+
+// SpanEvent is a named point in time within a span, such as a retry attempt,
+// a cache hit or a triggered guardrail.
+type SpanEvent struct {
+	Name       string         `json:"name"`
+	Timestamp  string         `json:"timestamp"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// AddEvent records a timestamped event on the span. Events are stored in
+// span_data.events in the order they were added. attrs may be nil.
+// To add events inside a Span closure, use GetCurrentSpan(ctx).AddEvent.
+// Safe for concurrent use, and safe to call on nil receiver (no-op).
+func (s *ActiveSpan) AddEvent(name string, attrs map[string]any) {
+	defer func() { recover() }()
+	if s == nil || s.client == nil || name == "" {
+		return
+	}
+	event := SpanEvent{
+		Name:       name,
+		Timestamp:  time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		Attributes: attrs,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
@@ -0,0 +1,81 @@
+package bitfab
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestAddEvent_RecordsTimestampedEventsInOrder(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "test", "Work")
+	span.AddEvent("retry", map[string]any{"attempt": 1})
+	span.AddEvent("cache_hit", nil)
+	span.AddEvent("", nil)
+	span.End()
+	span.AddEvent("after_end", nil)
+
+	events, ok := exp.spanData(0)["events"].([]SpanEvent)
+	if !ok || len(events) != 2 {
+		t.Fatalf("events = %v, want 2 events", exp.spanData(0)["events"])
+	}
+	if events[0].Name != "retry" || events[0].Attributes["attempt"] != 1 || events[1].Name != "cache_hit" {
+		t.Errorf("events = %+v", events)
+	}
+	rawSpan := rawSpanOf(exp.spans[0])
+	for _, e := range events {
+		if e.Timestamp < rawSpan["started_at"].(string) || e.Timestamp > rawSpan["ended_at"].(string) {
+			t.Errorf("event %s at %s is outside the span", e.Name, e.Timestamp)
+		}
+	}
+}
+
+func TestGetCurrentSpan_FromSpanClosure(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).AddEvent("guardrail_triggered", map[string]any{"rule": "pii"})
+		return nil, nil
+	})
+
+	events, _ := exp.spanData(0)["events"].([]SpanEvent)
+	if len(events) != 1 || events[0].Name != "guardrail_triggered" {
+		t.Errorf("events = %v", events)
+	}
+}
+
+func TestGetCurrentSpan_NoSpan(t *testing.T) {
+	if GetCurrentSpan(context.Background()) != nil {
+		t.Error("GetCurrentSpan should return nil outside a span")
+	}
+	// Remote parents have no local span to record on.
+	ctx := pushSpan(context.Background(), spanEntry{traceID: "t", spanID: "s", remote: true})
+	if GetCurrentSpan(ctx) != nil {
+		t.Error("GetCurrentSpan should return nil for a remote parent")
+	}
+	GetCurrentSpan(ctx).AddEvent("ignored", nil)
+}
+
+func TestAddEvent_Concurrent(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	ctx, span := client.Start(context.Background(), "test", "Work")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			GetCurrentSpan(ctx).AddEvent("tick", map[string]any{"i": i})
+		}(i)
+	}
+	wg.Wait()
+	span.End()
+
+	if events := exp.spanData(0)["events"].([]SpanEvent); len(events) != 10 {
+		t.Errorf("recorded %d events, want 10", len(events))
+	}
+}
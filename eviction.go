@@ -0,0 +1,148 @@
+package bitfab
+
+import (
+	"container/list"
+	"log"
+	"time"
+)
+
+// Default limits on open traces used when WithTraceTTL or WithMaxLiveTraces
+// is not set.
+const (
+	DefaultTraceTTL      = 1 * time.Hour
+	DefaultMaxLiveTraces = 10000
+)
+
+// liveTrace tracks a trace whose local root span has not ended yet.
+type liveTrace struct {
+	traceID    string
+	state      *TraceState
+	lastActive time.Time
+	// elem is the trace's position in Client.idle. It is nil once the local
+	// root has ended and is exporting the trace, which is then no longer
+	// eligible for eviction.
+	elem *list.Element
+}
+
+// WithTraceTTL sets how long a trace may stay open without activity before
+// its state is evicted as abandoned, e.g. because its root span was never
+// ended. Starting a span in the trace counts as activity. Defaults to
+// DefaultTraceTTL.
+func WithTraceTTL(ttl time.Duration) Option {
+	return func(c *Client) { c.traceTTL = ttl }
+}
+
+// WithMaxLiveTraces bounds the number of traces open at once. When a new
+// trace would exceed the limit, the least recently active trace is evicted.
+// Defaults to DefaultMaxLiveTraces. Reaching the limit is logged once; use
+// EvictedTraces to monitor evictions.
+func WithMaxLiveTraces(n int) Option {
+	return func(c *Client) { c.maxLiveTraces = n }
+}
+
+// EvictedTraces returns the number of open traces whose state was evicted,
+// either because they exceeded the trace TTL or to stay within the maximum
+// number of live traces. Spans of an evicted trace that end later are still
+// exported, but its trace completion is not sent.
+func (c *Client) EvictedTraces() int64 {
+	return c.evictions.Load()
+}
+
+// touch records activity on the trace of the given local root.
+func (c *Client) touch(localRootID string) {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	if lt := c.live[localRootID]; lt != nil {
+		lt.lastActive = time.Now()
+		if lt.elem != nil {
+			c.idle.MoveToBack(lt.elem)
+		}
+	}
+}
+
+// addLiveLocked starts tracking a new trace as the most recently active one.
+// c.pendingMu must be held.
+func (c *Client) addLiveLocked(localRootID string, lt *liveTrace) {
+	lt.elem = c.idle.PushBack(localRootID)
+	c.live[localRootID] = lt
+}
+
+// endingLocked marks a trace whose local root has ended, removing it from
+// the eviction order. c.pendingMu must be held.
+func (c *Client) endingLocked(lt *liveTrace) {
+	if lt.elem != nil {
+		c.idle.Remove(lt.elem)
+		lt.elem = nil
+	}
+}
+
+// removeLiveLocked stops tracking the trace with the given local root.
+// c.pendingMu must be held.
+func (c *Client) removeLiveLocked(localRootID string) {
+	if lt := c.live[localRootID]; lt != nil {
+		if lt.elem != nil {
+			c.idle.Remove(lt.elem)
+		}
+		delete(c.live, localRootID)
+	}
+}
+
+// sweepLocked evicts traces that exceeded the TTL, at most once per tenth of
+// the TTL, and then the least recently active traces until a new trace fits
+// within the live trace limit. c.idle keeps evictable traces ordered by
+// activity, so both only look at the traces they evict. c.pendingMu must be
+// held.
+func (c *Client) sweepLocked(now time.Time) {
+	ttl := c.traceTTL
+	if ttl <= 0 {
+		ttl = DefaultTraceTTL
+	}
+	if now.After(c.nextSweep) {
+		c.nextSweep = now.Add(ttl / 10)
+		expired := 0
+		for e := c.idle.Front(); e != nil; e = c.idle.Front() {
+			id := e.Value.(string)
+			if now.Sub(c.live[id].lastActive) <= ttl {
+				break
+			}
+			c.evictLocked(id)
+			expired++
+		}
+		if expired > 0 {
+			logEviction("bitfab: evicted %d traces abandoned for over %s", expired, ttl)
+		}
+	}
+
+	max := c.maxLiveTraces
+	if max <= 0 {
+		max = DefaultMaxLiveTraces
+	}
+	for len(c.live) >= max && c.idle.Len() > 0 {
+		if !c.maxLiveWarned {
+			c.maxLiveWarned = true
+			logEviction("bitfab: %d traces open, evicting the least recently active; see Client.EvictedTraces", max)
+		}
+		c.evictLocked(c.idle.Front().Value.(string))
+	}
+}
+
+// evictLocked drops all state of the trace with the given local root.
+// c.pendingMu must be held.
+func (c *Client) evictLocked(localRootID string) {
+	if c.live[localRootID] == nil {
+		return
+	}
+	c.removeLiveLocked(localRootID)
+	delete(c.pendingSpans, localRootID)
+	if d := c.deferred[localRootID]; d != nil {
+		c.buffered -= len(d.payloads)
+		delete(c.deferred, localRootID)
+	}
+	c.evictions.Add(1)
+	c.checkDrainedLocked()
+}
+
+func logEviction(format string, args ...any) {
+	defer func() { recover() }()
+	log.Printf(format, args...)
+}
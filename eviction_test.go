@@ -0,0 +1,166 @@
+package bitfab
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEviction_TTLEvictsAbandonedTraces(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithTraceTTL(20*time.Millisecond))
+
+	ctx, abandoned := client.Start(context.Background(), "test", "NeverEnded")
+	_, child := client.Start(ctx, "test", "Child")
+	traceID := abandoned.traceID
+
+	time.Sleep(40 * time.Millisecond)
+	_, next := client.Start(context.Background(), "test", "Next")
+	next.End()
+
+	if client.EvictedTraces() != 1 {
+		t.Errorf("EvictedTraces() = %d, want 1", client.EvictedTraces())
+	}
+	if traceStateOf(client, traceID) != nil {
+		t.Error("evicted trace state should be removed")
+	}
+	client.pendingMu.Lock()
+	if _, ok := client.pendingSpans[abandoned.spanID]; ok {
+		t.Error("evicted trace should not keep pending spans")
+	}
+	client.pendingMu.Unlock()
+
+	// Late spans of the evicted trace are exported without recreating state.
+	GetCurrentTrace(ctx).SetMetadata(map[string]any{"late": true})
+	child.End()
+	abandoned.End()
+	if traceStateOf(client, traceID) != nil {
+		t.Error("late activity should not recreate evicted trace state")
+	}
+	if len(exp.spans) != 3 || len(exp.traces) != 1 {
+		t.Errorf("exported %d spans and %d traces, want 3 spans and only Next's completion", len(exp.spans), len(exp.traces))
+	}
+	client.pendingMu.Lock()
+	defer client.pendingMu.Unlock()
+	if len(client.pendingSpans) != 0 || len(client.live) != 0 {
+		t.Errorf("pending spans = %d, live traces = %d, want none", len(client.pendingSpans), len(client.live))
+	}
+}
+
+func TestEviction_ActivityKeepsTraceAlive(t *testing.T) {
+	client := NewClient("test-key", WithExporter(&recordingExporter{}), WithTraceTTL(30*time.Millisecond))
+
+	ctx, root := client.Start(context.Background(), "test", "LongRunning")
+	for i := 0; i < 4; i++ {
+		time.Sleep(15 * time.Millisecond)
+		_, child := client.Start(ctx, "test", "Step")
+		child.End()
+	}
+	_, other := client.Start(context.Background(), "test", "Other")
+	other.End()
+	root.End()
+
+	if client.EvictedTraces() != 0 {
+		t.Errorf("EvictedTraces() = %d, want an active trace to be kept", client.EvictedTraces())
+	}
+}
+
+func TestEviction_MaxLiveTracesEvictsLeastRecentlyActive(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithMaxLiveTraces(2))
+
+	_, first := client.Start(context.Background(), "test", "First")
+	time.Sleep(time.Millisecond)
+	_, second := client.Start(context.Background(), "test", "Second")
+	time.Sleep(time.Millisecond)
+	_, third := client.Start(context.Background(), "test", "Third")
+
+	if client.EvictedTraces() != 1 {
+		t.Fatalf("EvictedTraces() = %d, want 1", client.EvictedTraces())
+	}
+	if traceStateOf(client, first.traceID) != nil {
+		t.Error("the oldest trace should be evicted")
+	}
+	if traceStateOf(client, second.traceID) == nil || traceStateOf(client, third.traceID) == nil {
+		t.Error("newer traces should be kept")
+	}
+
+	first.End()
+	second.End()
+	third.End()
+	if len(exp.traces) != 2 {
+		t.Errorf("sent %d trace completions, want 2", len(exp.traces))
+	}
+}
+
+func TestEviction_ActivityMovesTraceToBackOfEvictionOrder(t *testing.T) {
+	client := NewClient("test-key", WithExporter(&recordingExporter{}), WithMaxLiveTraces(2))
+
+	firstCtx, first := client.Start(context.Background(), "test", "First")
+	_, second := client.Start(context.Background(), "test", "Second")
+	_, child := client.Start(firstCtx, "test", "Child")
+	child.End()
+	client.Start(context.Background(), "test", "Third")
+
+	if traceStateOf(client, second.traceID) != nil {
+		t.Error("the least recently active trace should be evicted")
+	}
+	if traceStateOf(client, first.traceID) == nil {
+		t.Error("a trace with recent activity should be kept")
+	}
+}
+
+func TestEviction_MaxLiveTracesLogsOnce(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	client := NewClient("test-key", WithExporter(&recordingExporter{}), WithMaxLiveTraces(1))
+	for i := 0; i < 5; i++ {
+		client.Start(context.Background(), "test", "Abandoned")
+	}
+
+	if client.EvictedTraces() != 4 {
+		t.Errorf("EvictedTraces() = %d, want 4", client.EvictedTraces())
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 1 {
+		t.Errorf("logged %d lines for capacity evictions, want 1:\n%s", n, buf.String())
+	}
+}
+
+func TestEviction_ShutdownDoesNotWaitForEvictedTraces(t *testing.T) {
+	client := NewClient("test-key", WithExporter(&recordingExporter{}), WithMaxLiveTraces(1))
+
+	client.Start(context.Background(), "test", "Abandoned")
+	_, span := client.Start(context.Background(), "test", "Finished")
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() = %v, want nil once the abandoned trace was evicted", err)
+	}
+}
+
+func TestCurrentTrace_DoesNotRecreateFinishedTrace(t *testing.T) {
+	client := NewClient("test-key", WithExporter(&recordingExporter{}))
+
+	var trace *CurrentTrace
+	var traceID string
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		trace = GetCurrentTrace(ctx)
+		traceID = currentSpan(ctx).traceID
+		return nil, nil
+	})
+
+	trace.SetSessionID("s")
+	trace.SetMetadata(map[string]any{"k": "v"})
+	trace.AddContext(map[string]any{"k": "v"})
+	if traceStateOf(client, traceID) != nil {
+		t.Error("CurrentTrace setters should not recreate state after the root ended")
+	}
+}
@@ -0,0 +1,220 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Exporter delivers span and trace payloads produced by a Client.
+//
+// Span payloads have the shape sent to /api/sdk/externalSpans: "type",
+// "source", "sourceTraceId", "traceFunctionKey" and a "rawSpan" map holding
+// id, trace_id, parent_id, started_at, ended_at and span_data. Trace
+// payloads have the shape sent to /api/sdk/externalTraces, with the trace in
+// "externalTrace". Use MarshalSpanPayload to serialize either one.
+//
+// The default exporter sends payloads to the Bitfab HTTP API. Use WithExporter
+// to replace it, for example to write spans to a file or record them in tests.
+type Exporter interface {
+	// ExportSpan delivers a span payload and returns a channel that is closed
+	// once delivery has finished, successfully or not. Root spans wait on the
+	// channels of their children before the trace completion is exported.
+	ExportSpan(payload map[string]any) <-chan struct{}
+
+	// ExportTrace delivers a trace completion payload. It is called once per
+	// trace, after the root span and all of its children have been exported.
+	ExportTrace(payload map[string]any)
+
+	// Flush blocks until all pending deliveries have finished or the timeout
+	// elapses.
+	Flush(timeout time.Duration)
+
+	// Shutdown flushes pending deliveries and releases any resources held by
+	// the exporter. Payloads exported afterwards are dropped. It returns an
+	// error if ctx is done before delivery finished or payloads were lost,
+	// preferably a *ShutdownError with the number of lost payloads.
+	Shutdown(ctx context.Context) error
+}
+
+// ShutdownError is returned by Client.Shutdown and Exporter.Shutdown when
+// spans or trace completions could not be delivered. Payloads written to the
+// on-disk spool are not counted; they are replayed by a later process.
+type ShutdownError struct {
+	DroppedSpans  int
+	DroppedTraces int
+	// Err is the underlying cause, such as ctx.Err() when the shutdown
+	// deadline expired. It may be nil.
+	Err error
+}
+
+func (e *ShutdownError) Error() string {
+	msg := fmt.Sprintf("bitfab: shutdown: %d spans and %d traces not delivered", e.DroppedSpans, e.DroppedTraces)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ShutdownError) Unwrap() error { return e.Err }
+
+// HTTPOption configures an exporter created by NewHTTPExporter.
+type HTTPOption func(*httpConfig)
+
+type httpConfig struct {
+	batch *BatchOptions
+	spool *SpoolOptions
+	retry RetryPolicy
+}
+
+// WithHTTPBatching enables queued span delivery, as WithBatching does for the
+// client's default exporter.
+func WithHTTPBatching(opts BatchOptions) HTTPOption {
+	return func(c *httpConfig) { c.batch = &opts }
+}
+
+// WithHTTPSpool enables the on-disk spool, as WithSpool does for the client's
+// default exporter.
+func WithHTTPSpool(opts SpoolOptions) HTTPOption {
+	return func(c *httpConfig) { c.spool = &opts }
+}
+
+// WithHTTPRetryPolicy sets the retry policy for requests, as WithRetryPolicy
+// does for the client's default exporter.
+func WithHTTPRetryPolicy(policy RetryPolicy) HTTPOption {
+	return func(c *httpConfig) { c.retry = policy }
+}
+
+// NewHTTPExporter returns an Exporter that sends payloads to the Bitfab HTTP
+// API at serviceURL. This is the exporter NewClient uses by default; build it
+// explicitly to combine it with another exporter in NewMultiExporter.
+func NewHTTPExporter(apiKey, serviceURL string, opts ...HTTPOption) Exporter {
+	var cfg httpConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return newHTTPExporter(apiKey, serviceURL, cfg)
+}
+
+func newHTTPExporter(apiKey, serviceURL string, cfg httpConfig) *httpClient {
+	h := newHTTPClient(apiKey, serviceURL)
+	h.retry = cfg.retry.withDefaults()
+	if cfg.batch != nil {
+		h.batcher = newSpanBatcher(*cfg.batch, &h.wg, &h.stats, 1, h.deliverBatch)
+	}
+	if cfg.spool != nil {
+		sp, err := newSpool(h, *cfg.spool)
+		if err != nil {
+			log.Printf("bitfab: spool disabled: %v", err)
+		} else {
+			h.spool = sp
+		}
+	}
+	return h
+}
+
+// multiExporter fans payloads out to several exporters.
+type multiExporter []Exporter
+
+// NewMultiExporter returns an Exporter that delivers every payload to each of
+// exporters, for example to send spans to both the Bitfab API and an OTLP
+// collector:
+//
+//	client := bitfab.NewClient(apiKey, bitfab.WithExporter(bitfab.NewMultiExporter(
+//		bitfab.NewHTTPExporter(apiKey, bitfab.DefaultServiceURL),
+//		bitfab.NewOTLPExporter("http://localhost:4318/v1/traces"),
+//	)))
+//
+// A span counts as delivered once every exporter has finished with it.
+func NewMultiExporter(exporters ...Exporter) Exporter {
+	return multiExporter(exporters)
+}
+
+// ExportSpan implements Exporter.
+func (m multiExporter) ExportSpan(payload map[string]any) <-chan struct{} {
+	if len(m) == 1 {
+		return m[0].ExportSpan(payload)
+	}
+	chans := make([]<-chan struct{}, len(m))
+	for i, e := range m {
+		chans[i] = e.ExportSpan(payload)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, ch := range chans {
+			<-ch
+		}
+	}()
+	return done
+}
+
+// ExportTrace implements Exporter.
+func (m multiExporter) ExportTrace(payload map[string]any) {
+	for _, e := range m {
+		e.ExportTrace(payload)
+	}
+}
+
+// Flush implements Exporter. The exporters are flushed concurrently, so the
+// timeout applies to all of them together.
+func (m multiExporter) Flush(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for _, e := range m {
+		wg.Add(1)
+		go func(e Exporter) {
+			defer wg.Done()
+			e.Flush(timeout)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// flushQueue forwards the local root's flush hint to exporters that queue.
+func (m multiExporter) flushQueue() {
+	for _, e := range m {
+		if f, ok := e.(queueFlusher); ok {
+			f.flushQueue()
+		}
+	}
+}
+
+// Shutdown implements Exporter. The exporters are shut down concurrently and
+// their lost payloads are summed into a single *ShutdownError.
+func (m multiExporter) Shutdown(ctx context.Context) error {
+	errs := make([]error, len(m))
+	var wg sync.WaitGroup
+	for i, e := range m {
+		wg.Add(1)
+		go func(i int, e Exporter) {
+			defer wg.Done()
+			errs[i] = e.Shutdown(ctx)
+		}(i, e)
+	}
+	wg.Wait()
+
+	var total ShutdownError
+	failed := false
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		failed = true
+		var se *ShutdownError
+		if errors.As(err, &se) {
+			total.DroppedSpans += se.DroppedSpans
+			total.DroppedTraces += se.DroppedTraces
+			err = se.Err
+		}
+		if total.Err == nil {
+			total.Err = err
+		}
+	}
+	if !failed {
+		return nil
+	}
+	return &total
+}
@@ -0,0 +1,223 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingExporter is an Exporter that keeps every payload in memory.
+type recordingExporter struct {
+	mu       sync.Mutex
+	spans    []map[string]any
+	traces   []map[string]any
+	flushed  int
+	shutdown bool
+}
+
+func (e *recordingExporter) ExportSpan(payload map[string]any) <-chan struct{} {
+	e.mu.Lock()
+	e.spans = append(e.spans, payload)
+	e.mu.Unlock()
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (e *recordingExporter) ExportTrace(payload map[string]any) {
+	e.mu.Lock()
+	e.traces = append(e.traces, payload)
+	e.mu.Unlock()
+}
+
+func (e *recordingExporter) Flush(timeout time.Duration) {
+	e.mu.Lock()
+	e.flushed++
+	e.mu.Unlock()
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	e.shutdown = true
+	e.mu.Unlock()
+	return nil
+}
+
+// spanData returns the span_data of the i-th recorded span.
+func (e *recordingExporter) spanData(i int) map[string]any {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.spans[i]["rawSpan"].(map[string]any)["span_data"].(map[string]any)
+}
+
+func TestWithExporter_ReceivesSpansAndTraces(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	ctx := context.Background()
+
+	client.Span(ctx, "outer", func(ctx context.Context) (any, error) {
+		return client.Span(ctx, "inner", func(ctx context.Context) (any, error) {
+			return "inner-result", nil
+		})
+	})
+	client.FlushTraces(time.Second)
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+
+	if len(exp.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exp.spans))
+	}
+	if exp.spans[0]["traceFunctionKey"] != "inner" {
+		t.Errorf("first exported span = %v, want inner", exp.spans[0]["traceFunctionKey"])
+	}
+	if len(exp.traces) != 1 {
+		t.Fatalf("expected 1 trace completion, got %d", len(exp.traces))
+	}
+	if exp.traces[0]["completed"] != true {
+		t.Error("trace completion payload should have completed=true")
+	}
+	if exp.flushed != 1 {
+		t.Errorf("Flush called %d times, want 1", exp.flushed)
+	}
+}
+
+func TestWithExporter_DoesNotRequireAPIKey(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("", WithExporter(exp))
+	if !client.enabled {
+		t.Fatal("client with a custom exporter should be enabled without an API key")
+	}
+
+	_, span := client.Start(context.Background(), "test", "Test")
+	span.End()
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if len(exp.spans) != 1 {
+		t.Errorf("expected 1 span, got %d", len(exp.spans))
+	}
+}
+
+func TestWithExporter_RespectsDisabled(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithEnabled(false))
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		return nil, nil
+	})
+
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if len(exp.spans) != 0 {
+		t.Errorf("disabled client exported %d spans, want 0", len(exp.spans))
+	}
+}
+
+func TestNewHTTPExporter_Shutdown(t *testing.T) {
+	server := newSpanCaptureServer(t)
+	defer server.Close()
+
+	exp := NewHTTPExporter("test-key", server.URL)
+	<-exp.ExportSpan(map[string]any{"rawSpan": map[string]any{}})
+
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+}
+
+func TestNewHTTPExporter_Options(t *testing.T) {
+	server := newBatchCaptureServer(t)
+	defer server.Close()
+
+	exp := NewHTTPExporter("test-key", server.URL,
+		WithHTTPBatching(BatchOptions{FlushInterval: time.Millisecond, Workers: 1}),
+		WithHTTPRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	client := NewClient("test-key", WithExporter(exp))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+				return nil, nil
+			})
+		}()
+	}
+	wg.Wait()
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if len(server.spans) != 5 {
+		t.Errorf("expected 5 spans, got %d", len(server.spans))
+	}
+	if server.maxInFlight > 1 {
+		t.Errorf("expected at most 1 span request in flight, got %d", server.maxInFlight)
+	}
+}
+
+// lossyExporter is a recordingExporter whose Shutdown reports lost payloads.
+type lossyExporter struct {
+	recordingExporter
+	err error
+}
+
+func (e *lossyExporter) Shutdown(ctx context.Context) error {
+	e.recordingExporter.Shutdown(ctx)
+	return e.err
+}
+
+func TestMultiExporter_FansOut(t *testing.T) {
+	a, b := &recordingExporter{}, &recordingExporter{}
+	client := NewClient("test-key", WithExporter(NewMultiExporter(a, b)))
+	ctx := context.Background()
+
+	client.Span(ctx, "outer", func(ctx context.Context) (any, error) {
+		return client.Span(ctx, "inner", func(ctx context.Context) (any, error) {
+			return nil, nil
+		})
+	})
+	client.FlushTraces(time.Second)
+	if err := client.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	for name, exp := range map[string]*recordingExporter{"first": a, "second": b} {
+		exp.mu.Lock()
+		if len(exp.spans) != 2 || len(exp.traces) != 1 {
+			t.Errorf("%s exporter got %d spans and %d traces, want 2 and 1", name, len(exp.spans), len(exp.traces))
+		}
+		if exp.flushed == 0 || !exp.shutdown {
+			t.Errorf("%s exporter was not flushed and shut down", name)
+		}
+		exp.mu.Unlock()
+	}
+}
+
+func TestMultiExporter_ShutdownSumsLostPayloads(t *testing.T) {
+	a := &lossyExporter{err: &ShutdownError{DroppedSpans: 2, DroppedTraces: 1, Err: context.DeadlineExceeded}}
+	b := &lossyExporter{err: &ShutdownError{DroppedSpans: 3}}
+	c := &recordingExporter{}
+
+	err := NewMultiExporter(a, b, c).Shutdown(context.Background())
+
+	var se *ShutdownError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected *ShutdownError, got %v", err)
+	}
+	if se.DroppedSpans != 5 || se.DroppedTraces != 1 {
+		t.Errorf("got %d spans and %d traces dropped, want 5 and 1", se.DroppedSpans, se.DroppedTraces)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error to wrap context.DeadlineExceeded, got %v", err)
+	}
+	if !c.shutdown {
+		t.Error("healthy exporter was not shut down")
+	}
+}
@@ -2,39 +2,76 @@ package bitfab
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type httpClient struct {
 	apiKey     string
 	serviceURL string
+	retry      RetryPolicy
 	client     *http.Client
+	batcher    *spanBatcher
+	spool      *spool
 	wg         sync.WaitGroup
+	stats      deliveryStats
+	closeMu    sync.RWMutex
+	closed     bool
+}
+
+// deliveryStats counts payloads that are in flight or were lost, so Shutdown
+// can report what could not be delivered.
+type deliveryStats struct {
+	spansPending  atomic.Int64
+	spansDropped  atomic.Int64
+	tracesPending atomic.Int64
+	tracesDropped atomic.Int64
+}
+
+// apiError is an error reported by the Bitfab API in a successful response
+// body. Unlike transport and HTTP status errors, resending the same payload
+// will not succeed.
+type apiError struct {
+	msg string
+}
+
+func (e *apiError) Error() string { return e.msg }
+
+// spoolFailed writes an undeliverable payload to the on-disk spool, if one
+// is configured, so the background drainer can replay it later. It reports
+// whether the payload was spooled.
+func (h *httpClient) spoolFailed(endpoint string, payload map[string]any, err error) bool {
+	if h.spool == nil || !isRetryable(err) {
+		return false
+	}
+	if spoolErr := h.spool.write(endpoint, payload); spoolErr != nil {
+		log.Printf("bitfab: failed to spool payload: %v", spoolErr)
+		return false
+	}
+	return true
 }
 
 func newHTTPClient(apiKey, serviceURL string) *httpClient {
 	return &httpClient{
 		apiKey:     apiKey,
 		serviceURL: serviceURL,
+		retry:      RetryPolicy{}.withDefaults(),
 		client: &http.Client{
 			Timeout: 120 * time.Second,
 		},
 	}
 }
 
-// request makes a POST request to the Bitfab API.
+// request makes a POST request to the Bitfab API, retrying transient
+// failures according to the client's RetryPolicy.
 func (h *httpClient) request(endpoint string, payload map[string]any, opts ...requestOption) error {
-	cfg := requestConfig{
-		timeout:    0, // use default client timeout
-		maxRetries: 1,
-		retryDelay: 100 * time.Millisecond,
-	}
+	cfg := h.retry.requestConfig() // zero timeout uses the default client timeout
 	for _, opt := range opts {
 		opt(&cfg)
 	}
@@ -44,58 +81,43 @@ func (h *httpClient) request(endpoint string, payload map[string]any, opts ...re
 		return fmt.Errorf("bitfab: failed to marshal payload: %w", err)
 	}
 
-	var lastErr error
-	for attempt := 0; attempt < cfg.maxRetries; attempt++ {
-		if attempt > 0 {
-			time.Sleep(cfg.retryDelay)
-		}
-
-		client := h.client
-		if cfg.timeout > 0 {
-			client = &http.Client{Timeout: cfg.timeout}
-		}
+	client := h.client
+	if cfg.timeout > 0 {
+		client = &http.Client{Timeout: cfg.timeout}
+	}
 
+	respBody, err := doWithRetry(client, cfg, func() (*http.Request, error) {
 		req, err := http.NewRequest("POST", h.serviceURL+endpoint, bytes.NewReader(body))
 		if err != nil {
-			return fmt.Errorf("bitfab: failed to create request: %w", err)
+			return nil, err
 		}
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Authorization", "Bearer "+h.apiKey)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		respBody, _ := io.ReadAll(resp.Body)
-		resp.Body.Close()
-
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			lastErr = fmt.Errorf("bitfab: HTTP %d: %s", resp.StatusCode, string(respBody))
-			continue
-		}
-
-		// Check for error in response body
-		var result map[string]any
-		if json.Unmarshal(respBody, &result) == nil {
-			if errMsg, ok := result["error"].(string); ok {
-				if url, ok := result["url"].(string); ok {
-					return fmt.Errorf("%s Configure it at: %s%s", errMsg, h.serviceURL, url)
-				}
-				return fmt.Errorf("%s", errMsg)
+	// Check for error in response body
+	var result map[string]any
+	if json.Unmarshal(respBody, &result) == nil {
+		if errMsg, ok := result["error"].(string); ok {
+			if url, ok := result["url"].(string); ok {
+				return &apiError{msg: fmt.Sprintf("%s Configure it at: %s%s", errMsg, h.serviceURL, url)}
 			}
+			return &apiError{msg: errMsg}
 		}
-
-		return nil
 	}
-
-	return lastErr
+	return nil
 }
 
 // sendExternalSpan sends a span payload in the background and returns a channel
 // that is closed when the HTTP request completes. This allows callers to await
 // span delivery before sending trace completion.
+//
+// When batching is enabled the span is queued and delivered together with
+// other spans; the channel is closed once its batch has been sent.
 func (h *httpClient) sendExternalSpan(payload map[string]any) <-chan struct{} {
 	merged := make(map[string]any, len(payload)+1)
 	for k, v := range payload {
@@ -103,10 +125,26 @@ func (h *httpClient) sendExternalSpan(payload map[string]any) <-chan struct{} {
 	}
 	merged["sdkVersion"] = Version
 
+	h.closeMu.RLock()
+	defer h.closeMu.RUnlock()
+	if h.closed {
+		h.stats.spansDropped.Add(1)
+		log.Printf("bitfab: exporter is shut down, dropping span")
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+
+	if h.batcher != nil {
+		return h.batcher.enqueue(merged)
+	}
+
 	done := make(chan struct{})
+	h.stats.spansPending.Add(1)
 	h.wg.Add(1)
 	go func() {
 		defer h.wg.Done()
+		defer h.stats.spansPending.Add(-1)
 		defer close(done)
 		defer func() {
 			if r := recover(); r != nil {
@@ -117,12 +155,46 @@ func (h *httpClient) sendExternalSpan(payload map[string]any) <-chan struct{} {
 			}
 		}()
 		if err := h.request("/api/sdk/externalSpans", merged, withTimeout(30*time.Second)); err != nil {
+			if h.spoolFailed("/api/sdk/externalSpans", merged, err) {
+				return
+			}
+			h.stats.spansDropped.Add(1)
 			log.Printf("bitfab: failed to send external span: %v", err)
 		}
 	}()
 	return done
 }
 
+// deliverBatch sends queued spans. The Bitfab API has no batch endpoint, so
+// the batcher hands spans over one at a time.
+func (h *httpClient) deliverBatch(batch []queuedSpan) {
+	for _, item := range batch {
+		h.deliverQueued(item)
+	}
+}
+
+// deliverQueued sends a single queued span, spooling it if the API is
+// unreachable.
+func (h *httpClient) deliverQueued(item queuedSpan) {
+	defer close(item.done)
+	defer h.stats.spansPending.Add(-1)
+	defer func() {
+		if r := recover(); r != nil {
+			func() {
+				defer func() { recover() }()
+				log.Printf("bitfab: panic in background request: %v", r)
+			}()
+		}
+	}()
+	if err := h.request("/api/sdk/externalSpans", item.payload, withTimeout(30*time.Second)); err != nil {
+		if h.spoolFailed("/api/sdk/externalSpans", item.payload, err) {
+			return
+		}
+		h.stats.spansDropped.Add(1)
+		log.Printf("bitfab: failed to send external span: %v", err)
+	}
+}
+
 // sendExternalTrace sends a trace payload in the background (fire-and-forget).
 func (h *httpClient) sendExternalTrace(payload map[string]any) {
 	merged := make(map[string]any, len(payload)+1)
@@ -131,9 +203,32 @@ func (h *httpClient) sendExternalTrace(payload map[string]any) {
 	}
 	merged["sdkVersion"] = Version
 
+	h.closeMu.RLock()
+	defer h.closeMu.RUnlock()
+	if h.closed {
+		h.stats.tracesDropped.Add(1)
+		log.Printf("bitfab: exporter is shut down, dropping trace")
+		return
+	}
+
+	if h.spool != nil {
+		// A completion sent now would reach the API before the trace's
+		// spooled spans, so queue it behind them.
+		ts, _ := merged["externalTrace"].(map[string]any)
+		if traceID, _ := ts["id"].(string); traceID != "" && h.spool.holdsSpansOf(traceID) {
+			err := h.spool.write("/api/sdk/externalTraces", merged)
+			if err == nil {
+				return
+			}
+			log.Printf("bitfab: failed to spool payload: %v", err)
+		}
+	}
+
+	h.stats.tracesPending.Add(1)
 	h.wg.Add(1)
 	go func() {
 		defer h.wg.Done()
+		defer h.stats.tracesPending.Add(-1)
 		defer func() {
 			if r := recover(); r != nil {
 				func() {
@@ -143,15 +238,23 @@ func (h *httpClient) sendExternalTrace(payload map[string]any) {
 			}
 		}()
 		if err := h.request("/api/sdk/externalTraces", merged, withTimeout(10*time.Second)); err != nil {
+			if h.spoolFailed("/api/sdk/externalTraces", merged, err) {
+				return
+			}
+			h.stats.tracesDropped.Add(1)
 			log.Printf("bitfab: failed to send external trace: %v", err)
 		}
 	}()
 }
 
-// flush waits for all pending background goroutines to complete.
+// flush sends any queued span batches and waits for all pending background
+// goroutines to complete.
 func (h *httpClient) flush(timeout time.Duration) {
 	done := make(chan struct{})
 	go func() {
+		if h.batcher != nil {
+			h.batcher.flush()
+		}
 		h.wg.Wait()
 		close(done)
 	}()
@@ -162,13 +265,80 @@ func (h *httpClient) flush(timeout time.Duration) {
 	}
 }
 
+// flushQueue starts sending queued span batches without waiting for them.
+func (h *httpClient) flushQueue() {
+	if h.batcher != nil {
+		h.batcher.flushSoon()
+	}
+}
+
+// ExportSpan implements Exporter.
+func (h *httpClient) ExportSpan(payload map[string]any) <-chan struct{} {
+	return h.sendExternalSpan(payload)
+}
+
+// ExportTrace implements Exporter.
+func (h *httpClient) ExportTrace(payload map[string]any) {
+	h.sendExternalTrace(payload)
+}
+
+// Flush implements Exporter.
+func (h *httpClient) Flush(timeout time.Duration) {
+	h.flush(timeout)
+}
+
+// Shutdown implements Exporter. It stops accepting payloads, sends any
+// queued span batches, stops the batch worker and waits for in-flight
+// requests until ctx is done. The returned *ShutdownError counts every
+// payload this exporter failed to deliver, plus those still in flight if ctx
+// expired.
+func (h *httpClient) Shutdown(ctx context.Context) error {
+	h.closeMu.Lock()
+	h.closed = true
+	h.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		if h.batcher != nil {
+			h.batcher.stop()
+		}
+		h.wg.Wait()
+		if h.spool != nil {
+			h.spool.close()
+		}
+		close(done)
+	}()
+
+	var ctxErr error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+
+	spans := h.stats.spansDropped.Load()
+	traces := h.stats.tracesDropped.Load()
+	if ctxErr != nil {
+		spans += h.stats.spansPending.Load()
+		traces += h.stats.tracesPending.Load()
+	}
+	if spans == 0 && traces == 0 && ctxErr == nil {
+		return nil
+	}
+	return &ShutdownError{DroppedSpans: int(spans), DroppedTraces: int(traces), Err: ctxErr}
+}
+
 // requestOption configures a single request.
 type requestOption func(*requestConfig)
 
 type requestConfig struct {
-	timeout    time.Duration
-	maxRetries int
-	retryDelay time.Duration
+	timeout       time.Duration
+	maxRetries    int // total attempts, including the first
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+	multiplier    float64
+	jitter        float64
+	maxRetryAfter time.Duration
 }
 
 func withTimeout(d time.Duration) requestOption {
@@ -0,0 +1,286 @@
+package bitfab
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"unicode/utf8"
+)
+
+// Default payload limits used when a PayloadLimits field is left at zero.
+const (
+	DefaultMaxStringBytes = 32 << 10
+	DefaultMaxItems       = 1000
+	DefaultMaxDepth       = 32
+	DefaultMaxFieldBytes  = 256 << 10
+	DefaultMaxSpanBytes   = 1 << 20
+)
+
+// minFitStringBytes and minFitItems are the smallest string and item limits
+// tried when shrinking a field to fit a byte limit.
+const (
+	minFitStringBytes = 64
+	minFitItems       = 1
+)
+
+// PayloadLimits bounds the size of span and trace data. See WithPayloadLimits.
+type PayloadLimits struct {
+	// MaxStringBytes bounds each string. Longer strings keep their first
+	// MaxStringBytes bytes followed by "...[truncated N of M bytes]".
+	MaxStringBytes int
+	// MaxItems bounds each slice and map, and the number of span events.
+	// Longer slices keep their first MaxItems elements followed by
+	// "...[truncated N of M items]"; larger maps keep MaxItems keys in sorted
+	// order and a "..." key describing the rest.
+	MaxItems int
+	// MaxDepth bounds nesting. Values nested deeper are replaced by
+	// "[truncated: nested deeper than N levels]".
+	MaxDepth int
+	// MaxFieldBytes bounds the JSON encoding of each field, such as the
+	// input, output or trace metadata. Oversized fields are truncated further
+	// until they fit, or replaced by "[truncated: N bytes exceeds the limit
+	// of M]".
+	MaxFieldBytes int
+	// MaxSpanBytes bounds the JSON encoding of all fields of a span together,
+	// including its events and links. The largest fields are shrunk first;
+	// events and links that do not fit even without attributes are dropped
+	// from the end and counted in a "truncated" event and span_data's
+	// dropped_links.
+	MaxSpanBytes int
+}
+
+func (l PayloadLimits) withDefaults() PayloadLimits {
+	if l.MaxStringBytes <= 0 {
+		l.MaxStringBytes = DefaultMaxStringBytes
+	}
+	if l.MaxItems <= 0 {
+		l.MaxItems = DefaultMaxItems
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = DefaultMaxDepth
+	}
+	if l.MaxFieldBytes <= 0 {
+		l.MaxFieldBytes = DefaultMaxFieldBytes
+	}
+	if l.MaxSpanBytes <= 0 {
+		l.MaxSpanBytes = DefaultMaxSpanBytes
+	}
+	return l
+}
+
+// WithPayloadLimits truncates span inputs, outputs, prompts, chat messages,
+// contexts, event and link attributes and error text, and trace metadata and
+// contexts, before export, so oversized spans are still delivered in a useful
+// form:
+//
+//	bitfab.WithPayloadLimits(bitfab.PayloadLimits{MaxStringBytes: 4096})
+//
+// Every truncation leaves a marker recording how much was cut. Limited values
+// are exported in their JSON form (maps, slices and primitives), so the
+// original values passed to SetInput or SetOutput are never modified.
+func WithPayloadLimits(limits PayloadLimits) Option {
+	return func(c *Client) {
+		limits = limits.withDefaults()
+		c.sanitizer.limits = &limits
+	}
+}
+
+// truncateString cuts s to at most max bytes on a rune boundary and appends a
+// truncation marker.
+func truncateString(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...[truncated %d of %d bytes]", s[:cut], len(s)-cut, len(s))
+}
+
+// encodedSize returns the length of the JSON encoding of v, or 0 if it
+// cannot be encoded.
+func encodedSize(v any) int {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// fit shrinks the sanitized value v until its JSON encoding is at most limit
+// bytes, by repeatedly halving the string and item limits. If even the
+// smallest limits are too large, v is replaced by a marker.
+func (l *PayloadLimits) fit(v any, limit int) any {
+	size := encodedSize(v)
+	if size <= limit {
+		return v
+	}
+	shrunk := *l
+	for shrunk.MaxStringBytes > minFitStringBytes || shrunk.MaxItems > minFitItems {
+		shrunk.MaxStringBytes = max(shrunk.MaxStringBytes/2, minFitStringBytes)
+		shrunk.MaxItems = max(shrunk.MaxItems/2, minFitItems)
+		s := sanitizer{limits: &shrunk}
+		out := s.walk(reflect.ValueOf(v), 0)
+		if encodedSize(out) <= limit {
+			return out
+		}
+	}
+	return fmt.Sprintf("[truncated: %d bytes exceeds the limit of %d]", size, limit)
+}
+
+// fittedSpanFields are the span_data fields counted against MaxSpanBytes,
+// besides events and links.
+var fittedSpanFields = []string{"input", "output", "prompt", "contexts", "input_messages", "output_messages", "error", "error_info", "panic"}
+
+// fitSpan shrinks the largest sanitized fields of spanData and the span's
+// links, largest first, until together they fit in MaxSpanBytes. It returns
+// the fitted links.
+func (l *PayloadLimits) fitSpan(spanData map[string]any, links []Link) []Link {
+	sizes := map[string]int{}
+	total := 0
+	for _, key := range fittedSpanFields {
+		if v, ok := spanData[key]; ok {
+			sizes[key] = encodedSize(v)
+			total += sizes[key]
+		}
+	}
+	events, hasEvents := spanData["events"].([]SpanEvent)
+	if hasEvents {
+		sizes["events"] = encodedSize(events)
+		total += sizes["events"]
+	}
+	if len(links) > 0 {
+		sizes["links"] = encodedSize(links)
+		total += sizes["links"]
+	}
+
+	for total > l.MaxSpanBytes && len(sizes) > 0 {
+		largest := ""
+		for key, size := range sizes {
+			if largest == "" || size > sizes[largest] || (size == sizes[largest] && key < largest) {
+				largest = key
+			}
+		}
+		size := sizes[largest]
+		delete(sizes, largest)
+
+		budget := max(size-(total-l.MaxSpanBytes), 0)
+		switch largest {
+		case "events":
+			events = l.fitEvents(events, budget)
+			spanData["events"] = events
+			total += encodedSize(events) - size
+		case "links":
+			var dropped int
+			links, dropped = l.fitLinks(links, budget)
+			if dropped > 0 {
+				spanData["dropped_links"] = dropped
+			}
+			total += encodedSize(links) - size
+		default:
+			spanData[largest] = l.fit(spanData[largest], budget)
+			total += encodedSize(spanData[largest]) - size
+		}
+	}
+	return links
+}
+
+// fitAttributes shrinks a list of sanitized attribute maps, with the same
+// halving limits as fit, until size reports at most limit bytes. If even the
+// smallest limits are too large, all attributes are dropped. It reports
+// whether the result fits.
+func (l *PayloadLimits) fitAttributes(attrs []map[string]any, limit int, size func([]map[string]any) int) ([]map[string]any, bool) {
+	if size(attrs) <= limit {
+		return attrs, true
+	}
+	shrunk := *l
+	for shrunk.MaxStringBytes > minFitStringBytes || shrunk.MaxItems > minFitItems {
+		shrunk.MaxStringBytes = max(shrunk.MaxStringBytes/2, minFitStringBytes)
+		shrunk.MaxItems = max(shrunk.MaxItems/2, minFitItems)
+		s := sanitizer{limits: &shrunk}
+		out := make([]map[string]any, len(attrs))
+		for i, a := range attrs {
+			out[i], _ = s.walk(reflect.ValueOf(a), 0).(map[string]any)
+		}
+		if size(out) <= limit {
+			return out, true
+		}
+	}
+	out := make([]map[string]any, len(attrs))
+	return out, size(out) <= limit
+}
+
+// fitEvents shrinks event attributes until the events encode to at most limit
+// bytes. If the events do not fit even without attributes, trailing events
+// are dropped and counted in a final "truncated" event.
+func (l *PayloadLimits) fitEvents(events []SpanEvent, limit int) []SpanEvent {
+	withAttrs := func(attrs []map[string]any) []SpanEvent {
+		out := make([]SpanEvent, len(events))
+		for i, e := range events {
+			e.Attributes = attrs[i]
+			out[i] = e
+		}
+		return out
+	}
+	attrs := make([]map[string]any, len(events))
+	for i, e := range events {
+		attrs[i] = e.Attributes
+	}
+	attrs, ok := l.fitAttributes(attrs, limit, func(a []map[string]any) int { return encodedSize(withAttrs(a)) })
+	out := withAttrs(attrs)
+	if ok {
+		return out
+	}
+
+	// An earlier "truncated" event from the MaxItems limit is folded into
+	// the new one.
+	original := len(events)
+	if last := events[len(events)-1]; last.Name == "truncated" {
+		if n, ok := last.Attributes["original_events"].(int); ok {
+			original = n
+			out = out[:len(out)-1]
+		}
+	}
+	for n := len(out) / 2; ; n /= 2 {
+		kept := append(out[:n:n], SpanEvent{
+			Name:      "truncated",
+			Timestamp: events[len(events)-1].Timestamp,
+			Attributes: map[string]any{
+				"elided_events":   original - n,
+				"original_events": original,
+			},
+		})
+		if n == 0 || encodedSize(kept) <= limit {
+			return kept
+		}
+	}
+}
+
+// fitLinks shrinks link attributes until the links encode to at most limit
+// bytes. If the links do not fit even without attributes, trailing links are
+// dropped; it returns the kept links and the number dropped.
+func (l *PayloadLimits) fitLinks(links []Link, limit int) ([]Link, int) {
+	withAttrs := func(attrs []map[string]any) []Link {
+		out := make([]Link, len(links))
+		for i, link := range links {
+			link.Attributes = attrs[i]
+			out[i] = link
+		}
+		return out
+	}
+	attrs := make([]map[string]any, len(links))
+	for i, link := range links {
+		attrs[i] = link.Attributes
+	}
+	attrs, ok := l.fitAttributes(attrs, limit, func(a []map[string]any) int { return encodedSize(withAttrs(a)) })
+	out := withAttrs(attrs)
+	if ok {
+		return out, 0
+	}
+	n := len(out) / 2
+	for n > 0 && encodedSize(out[:n]) > limit {
+		n /= 2
+	}
+	return out[:n], len(out) - n
+}
@@ -0,0 +1,262 @@
+package bitfab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPayloadLimits_TruncatesStrings(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxStringBytes: 5}))
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).SetInput("hello world")
+		return "日本語", nil
+	})
+
+	spanData := exp.spanData(0)
+	if got := spanData["input"]; got != "hello...[truncated 6 of 11 bytes]" {
+		t.Errorf("input = %q", got)
+	}
+	if got := spanData["output"]; got != "日...[truncated 6 of 9 bytes]" {
+		t.Errorf("output = %q, want the cut on a rune boundary", got)
+	}
+}
+
+func TestTruncateString_ShortStringsUntouched(t *testing.T) {
+	if got := truncateString("short", 10); got != "short" {
+		t.Errorf("truncateString = %q, want short strings untouched", got)
+	}
+}
+
+func TestPayloadLimits_TruncatesSlicesMapsAndDepth(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxItems: 2, MaxDepth: 2}))
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		return map[string]any{
+			"list":   []int{1, 2, 3, 4, 5},
+			"nested": map[string]any{"a": map[string]any{"b": 1}},
+		}, nil
+	})
+
+	output := exp.spanData(0)["output"].(map[string]any)
+	list := output["list"].([]any)
+	if len(list) != 3 || list[0] != 1 || list[1] != 2 || list[2] != "...[truncated 3 of 5 items]" {
+		t.Errorf("list = %v", list)
+	}
+	if got := output["nested"].(map[string]any)["a"].(map[string]any)["b"]; got != "[truncated: nested deeper than 2 levels]" {
+		t.Errorf("nested.a.b = %v", got)
+	}
+
+	exp = &recordingExporter{}
+	client = NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxItems: 2}))
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		return map[string]int{"c": 3, "a": 1, "d": 4, "b": 2}, nil
+	})
+	output = exp.spanData(0)["output"].(map[string]any)
+	if len(output) != 3 || output["a"] != 1 || output["b"] != 2 || output["..."] != "[truncated 2 of 4 keys]" {
+		t.Errorf("map = %v, want the first two keys in sorted order and a marker", output)
+	}
+}
+
+func TestPayloadLimits_LargeOutputIsDeliveredWithinLimits(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{}))
+
+	doc := strings.Repeat("x", 5<<20)
+	pages := make([]string, 5000)
+	for i := range pages {
+		pages[i] = fmt.Sprintf("page %d", i)
+	}
+	client.Span(context.Background(), "summarize", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).SetInput(map[string]any{"pages": pages})
+		return doc, nil
+	})
+
+	spanData := exp.spanData(0)
+	output := spanData["output"].(string)
+	if !strings.HasSuffix(output, fmt.Sprintf("...[truncated %d of %d bytes]", len(doc)-DefaultMaxStringBytes, len(doc))) {
+		t.Errorf("output ends with %q", output[len(output)-50:])
+	}
+	input := spanData["input"].(map[string]any)["pages"].([]any)
+	if input[len(input)-1] != "...[truncated 4000 of 5000 items]" {
+		t.Errorf("last page = %v", input[len(input)-1])
+	}
+
+	b, err := MarshalSpanPayload(exp.spans[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) > DefaultMaxSpanBytes+4096 {
+		t.Errorf("payload is %d bytes, want at most about %d", len(b), DefaultMaxSpanBytes)
+	}
+	if len(doc) != 5<<20 || len(pages) != 5000 {
+		t.Error("caller's values were modified")
+	}
+}
+
+func TestPayloadLimits_FieldBytes(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxFieldBytes: 1000}))
+
+	rows := make([]map[string]any, 100)
+	for i := range rows {
+		rows[i] = map[string]any{"id": i, "text": strings.Repeat("y", 100)}
+	}
+	client.Span(context.Background(), "query", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).SetInput("select *")
+		return rows, nil
+	})
+
+	spanData := exp.spanData(0)
+	out, _ := json.Marshal(spanData["output"])
+	if len(out) > 1000 {
+		t.Errorf("output is %d bytes, want at most 1000", len(out))
+	}
+	got := spanData["output"].([]any)
+	if !strings.HasPrefix(got[len(got)-1].(string), "...[truncated ") {
+		t.Errorf("output should end with a truncation marker: %v", got[len(got)-1])
+	}
+	if spanData["input"] != "select *" {
+		t.Errorf("input = %v, want small fields untouched", spanData["input"])
+	}
+}
+
+func TestPayloadLimits_FieldBytesMarker(t *testing.T) {
+	l := PayloadLimits{}.withDefaults()
+	big := map[string]any{"a": strings.Repeat("z", 200)}
+	if got := l.fit(big, 10); got != "[truncated: 208 bytes exceeds the limit of 10]" {
+		t.Errorf("fit = %v", got)
+	}
+}
+
+func TestPayloadLimits_SpanBytesShrinksLargestField(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxSpanBytes: 3000}))
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).SetInput(strings.Repeat("i", 1000))
+		return strings.Repeat("o", 10000), nil
+	})
+
+	spanData := exp.spanData(0)
+	if got := spanData["input"]; got != strings.Repeat("i", 1000) {
+		t.Error("smaller input should be kept in full")
+	}
+	total := 0
+	for _, key := range []string{"input", "output"} {
+		b, _ := json.Marshal(spanData[key])
+		total += len(b)
+	}
+	if total > 3000 {
+		t.Errorf("input and output take %d bytes, want at most 3000", total)
+	}
+	if !strings.Contains(spanData["output"].(string), "...[truncated ") {
+		t.Errorf("output should carry a truncation marker")
+	}
+}
+
+func TestPayloadLimits_Events(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxItems: 2, MaxStringBytes: 3}))
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		span := GetCurrentSpan(ctx)
+		for i := 0; i < 5; i++ {
+			span.AddEvent("chunk", map[string]any{"text": "abcdef"})
+		}
+		return nil, nil
+	})
+
+	events := exp.spanData(0)["events"].([]SpanEvent)
+	if len(events) != 3 {
+		t.Fatalf("exported %d events, want 2 and a truncation event", len(events))
+	}
+	if events[0].Attributes["text"] != "abc...[truncated 3 of 6 bytes]" {
+		t.Errorf("event attributes = %v", events[0].Attributes)
+	}
+	if last := events[2]; last.Name != "truncated" || last.Attributes["elided_events"] != 3 || last.Attributes["original_events"] != 5 {
+		t.Errorf("truncation event = %+v", last)
+	}
+}
+
+func TestPayloadLimits_SpanBytesIncludesEventsAndLinks(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{}))
+
+	big := strings.Repeat("x", 30000)
+	link := Link{TraceID: "t1", SpanID: "s1", Attributes: map[string]any{}}
+	for i := 0; i < 100; i++ {
+		link.Attributes[fmt.Sprintf("k%d", i)] = big
+	}
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		span := GetCurrentSpan(ctx)
+		for i := 0; i < 100; i++ {
+			span.AddEvent("chunk", map[string]any{"a": big, "b": big})
+		}
+		return nil, nil
+	}, WithLinks(link))
+
+	b, _ := json.Marshal(rawSpanOf(exp.spans[0]))
+	if len(b) > DefaultMaxSpanBytes+4096 {
+		t.Errorf("span encodes to %d bytes, want about %d at most", len(b), DefaultMaxSpanBytes)
+	}
+	if events := exp.spanData(0)["events"].([]SpanEvent); len(events) != 100 {
+		t.Errorf("exported %d events, want all 100 with shrunk attributes", len(events))
+	}
+	if links := rawSpanOf(exp.spans[0])["links"].([]Link); len(links) != 1 || links[0].TraceID != "t1" {
+		t.Errorf("links = %v", links)
+	}
+}
+
+func TestPayloadLimits_DropsEventsAndLinksThatDoNotFit(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxSpanBytes: 2000}))
+
+	var links []Link
+	for i := 0; i < 50; i++ {
+		links = append(links, Link{TraceID: fmt.Sprintf("trace-%d", i), SpanID: fmt.Sprintf("span-%d", i)})
+	}
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		span := GetCurrentSpan(ctx)
+		for i := 0; i < 50; i++ {
+			span.AddEvent("chunk", nil)
+		}
+		return nil, nil
+	}, WithLinks(links...))
+
+	spanData := exp.spanData(0)
+	events := spanData["events"].([]SpanEvent)
+	last := events[len(events)-1]
+	if last.Name != "truncated" || last.Attributes["original_events"] != 50 || last.Attributes["elided_events"] != 50-(len(events)-1) {
+		t.Errorf("truncation event = %+v with %d events kept", last, len(events)-1)
+	}
+	kept := rawSpanOf(exp.spans[0])["links"].([]Link)
+	if spanData["dropped_links"] != 50-len(kept) || len(kept) == 50 {
+		t.Errorf("kept %d links, dropped_links = %v", len(kept), spanData["dropped_links"])
+	}
+	eb, _ := json.Marshal(events)
+	lb, _ := json.Marshal(kept)
+	if len(eb)+len(lb) > 2000 {
+		t.Errorf("events and links take %d bytes, want at most 2000", len(eb)+len(lb))
+	}
+}
+
+func TestPayloadLimits_TraceMetadata(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPayloadLimits(PayloadLimits{MaxStringBytes: 4}))
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		GetCurrentTrace(ctx).SetMetadata(map[string]any{"query": "a long query"})
+		return nil, nil
+	})
+
+	md := exp.traces[0]["externalTrace"].(map[string]any)["metadata"].(map[string]any)
+	if md["query"] != "a lo...[truncated 8 of 12 bytes]" {
+		t.Errorf("metadata = %v", md)
+	}
+}
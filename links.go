@@ -0,0 +1,48 @@
+package bitfab
+
+import "context"
+
+// Link relates a span to a span in another trace, for example a queued job
+// to the request that enqueued it, or a batch job to each of its inputs.
+// Unlike the parent, links do not affect the shape of either trace.
+type Link struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// LinkFromContext returns a Link to the current span in ctx with the given
+// attributes. Capture it when enqueuing work and pass it to WithLinks when
+// the work is processed:
+//
+//	job.Link, _ = bitfab.LinkFromContext(ctx, map[string]any{"queue": "emails"})
+//	...
+//	ctx, span := client.Start(ctx, "email-worker", "SendEmail", bitfab.WithLinks(job.Link))
+//
+// It returns false if ctx has no span.
+func LinkFromContext(ctx context.Context, attrs map[string]any) (Link, bool) {
+	entry := currentSpan(ctx)
+	if entry == nil {
+		return Link{}, false
+	}
+	return Link{TraceID: entry.traceID, SpanID: entry.spanID, Attributes: attrs}, true
+}
+
+// WithLinks links the span to spans in other traces. Links are recorded in
+// the raw span's links list.
+func WithLinks(links ...Link) SpanOption {
+	return func(c *spanConfig) { c.links = append(c.links, links...) }
+}
+
+// AddLink links the span to a span in another trace. Links with an empty
+// trace or span ID are ignored.
+// Safe for concurrent use, and safe to call on nil receiver (no-op).
+func (s *ActiveSpan) AddLink(link Link) {
+	defer func() { recover() }()
+	if s == nil || s.client == nil || link.TraceID == "" || link.SpanID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.links = append(s.links, link)
+}
@@ -0,0 +1,62 @@
+package bitfab
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLinks_QueuedJobLinksToEnqueuingRequest(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	reqCtx, request := client.Start(context.Background(), "api", "Enqueue")
+	link, ok := LinkFromContext(reqCtx, map[string]any{"queue": "emails"})
+	if !ok {
+		t.Fatal("LinkFromContext should find the request span")
+	}
+	request.End()
+
+	_, job := client.Start(context.Background(), "worker", "SendEmail", WithLinks(link))
+	job.End()
+
+	jobRaw := rawSpanOf(exp.spans[1])
+	if jobRaw["trace_id"] == request.traceID {
+		t.Fatal("job should start a new trace")
+	}
+	links, ok := jobRaw["links"].([]Link)
+	if !ok || len(links) != 1 {
+		t.Fatalf("links = %v", jobRaw["links"])
+	}
+	if links[0].TraceID != request.traceID || links[0].SpanID != request.spanID || links[0].Attributes["queue"] != "emails" {
+		t.Errorf("link = %+v, want request span %s/%s", links[0], request.traceID, request.spanID)
+	}
+	if _, ok := rawSpanOf(exp.spans[0])["links"]; ok {
+		t.Error("spans without links should omit the links field")
+	}
+}
+
+func TestLinks_AddLinkAndSpanOption(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	a := Link{TraceID: "trace-a", SpanID: "span-a"}
+	b := Link{TraceID: "trace-b", SpanID: "span-b"}
+	client.Span(context.Background(), "batch", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).AddLink(b)
+		GetCurrentSpan(ctx).AddLink(Link{TraceID: "missing-span-id"})
+		return nil, nil
+	}, WithLinks(a))
+
+	links := rawSpanOf(exp.spans[0])["links"].([]Link)
+	if len(links) != 2 || links[0].TraceID != "trace-a" || links[1].TraceID != "trace-b" {
+		t.Errorf("links = %+v, want [a b]", links)
+	}
+}
+
+func TestLinkFromContext_NoSpan(t *testing.T) {
+	if _, ok := LinkFromContext(context.Background(), nil); ok {
+		t.Error("LinkFromContext should report false outside a span")
+	}
+	var span *ActiveSpan
+	span.AddLink(Link{TraceID: "t", SpanID: "s"})
+}
@@ -0,0 +1,160 @@
+package bitfab
+
+// TokenUsage is the token consumption of an LLM call. If TotalTokens is zero,
+// it is computed as PromptTokens + CompletionTokens.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u TokenUsage) withTotal() TokenUsage {
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	return u
+}
+
+// Pricer computes the cost of an LLM call from its model and token usage.
+// It returns false if the model has no known price.
+type Pricer interface {
+	Cost(model string, usage TokenUsage) (float64, bool)
+}
+
+// ModelPrice is the price of a model in cost units (typically USD) per
+// million tokens.
+type ModelPrice struct {
+	PromptPerMillion     float64
+	CompletionPerMillion float64
+}
+
+// PriceTable is a Pricer that looks up per-token prices by model name.
+//
+//	client := bitfab.NewClient(apiKey, bitfab.WithPricer(bitfab.PriceTable{
+//	    "gpt-4o":      {PromptPerMillion: 2.50, CompletionPerMillion: 10.00},
+//	    "gpt-4o-mini": {PromptPerMillion: 0.15, CompletionPerMillion: 0.60},
+//	}))
+type PriceTable map[string]ModelPrice
+
+// Cost implements Pricer.
+func (t PriceTable) Cost(model string, usage TokenUsage) (float64, bool) {
+	price, ok := t[model]
+	if !ok {
+		return 0, false
+	}
+	cost := float64(usage.PromptTokens)*price.PromptPerMillion/1e6 +
+		float64(usage.CompletionTokens)*price.CompletionPerMillion/1e6
+	return cost, true
+}
+
+// llmData holds the LLM-specific fields of a span. Unset fields are omitted
+// from span data.
+type llmData struct {
+	model       string
+	provider    string
+	usage       *TokenUsage
+	temperature *float64
+	cost        *float64
+}
+
+// apply writes the LLM fields into spanData under their well-known keys. If
+// no cost was set explicitly, it is computed with pricer when the model and
+// token usage are known.
+func (d llmData) apply(spanData map[string]any, pricer Pricer) {
+	if d.model != "" {
+		spanData["model"] = d.model
+	}
+	if d.provider != "" {
+		spanData["provider"] = d.provider
+	}
+	if d.usage != nil {
+		spanData["usage"] = d.usage.withTotal()
+	}
+	if d.temperature != nil {
+		spanData["temperature"] = *d.temperature
+	}
+	if d.cost != nil {
+		spanData["cost"] = *d.cost
+	} else if pricer != nil && d.model != "" && d.usage != nil {
+		if cost, ok := pricer.Cost(d.model, *d.usage); ok {
+			spanData["cost"] = cost
+		}
+	}
+}
+
+// WithModel sets the LLM model name recorded in span_data.model.
+func WithModel(model string) SpanOption {
+	return func(c *spanConfig) { c.llm.model = model }
+}
+
+// WithProvider sets the LLM provider (e.g. "openai") recorded in span_data.provider.
+func WithProvider(provider string) SpanOption {
+	return func(c *spanConfig) { c.llm.provider = provider }
+}
+
+// WithTokenUsage sets the token usage recorded in span_data.usage.
+func WithTokenUsage(usage TokenUsage) SpanOption {
+	return func(c *spanConfig) { c.llm.usage = &usage }
+}
+
+// WithTemperature sets the sampling temperature recorded in span_data.temperature.
+func WithTemperature(temperature float64) SpanOption {
+	return func(c *spanConfig) { c.llm.temperature = &temperature }
+}
+
+// WithCost sets the cost recorded in span_data.cost, overriding any cost
+// computed by the client's Pricer.
+func WithCost(cost float64) SpanOption {
+	return func(c *spanConfig) { c.llm.cost = &cost }
+}
+
+// SetModel records the LLM model name.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetModel(model string) {
+	defer func() { recover() }()
+	if s == nil {
+		return
+	}
+	s.llm.model = model
+}
+
+// SetProvider records the LLM provider, e.g. "openai" or "anthropic".
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetProvider(provider string) {
+	defer func() { recover() }()
+	if s == nil {
+		return
+	}
+	s.llm.provider = provider
+}
+
+// SetTokenUsage records the token usage of the LLM call.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetTokenUsage(usage TokenUsage) {
+	defer func() { recover() }()
+	if s == nil {
+		return
+	}
+	s.llm.usage = &usage
+}
+
+// SetTemperature records the sampling temperature of the LLM call.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetTemperature(temperature float64) {
+	defer func() { recover() }()
+	if s == nil {
+		return
+	}
+	s.llm.temperature = &temperature
+}
+
+// SetCost records the cost of the LLM call, overriding any cost computed by
+// the client's Pricer.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetCost(cost float64) {
+	defer func() { recover() }()
+	if s == nil {
+		return
+	}
+	s.llm.cost = &cost
+}
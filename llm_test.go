@@ -0,0 +1,111 @@
+package bitfab
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestLLMSetters_RecordWellKnownFields(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Completion", WithType("llm"))
+	span.SetModel("gpt-4o")
+	span.SetProvider("openai")
+	span.SetTokenUsage(TokenUsage{PromptTokens: 120, CompletionTokens: 30})
+	span.SetTemperature(0.2)
+	span.SetCost(0.0015)
+	span.End()
+
+	spanData := exp.spanData(0)
+	if spanData["model"] != "gpt-4o" || spanData["provider"] != "openai" {
+		t.Errorf("model/provider = %v/%v", spanData["model"], spanData["provider"])
+	}
+	want := TokenUsage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150}
+	if spanData["usage"] != want {
+		t.Errorf("usage = %v, want %v", spanData["usage"], want)
+	}
+	if spanData["temperature"] != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", spanData["temperature"])
+	}
+	if spanData["cost"] != 0.0015 {
+		t.Errorf("cost = %v, want 0.0015", spanData["cost"])
+	}
+}
+
+func TestLLMFields_OmittedWhenUnset(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Completion")
+	span.End()
+
+	spanData := exp.spanData(0)
+	for _, key := range []string{"model", "provider", "usage", "temperature", "cost"} {
+		if _, ok := spanData[key]; ok {
+			t.Errorf("%s should be omitted when unset", key)
+		}
+	}
+}
+
+func TestLLMSpanOptions(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	client.Span(context.Background(), "chat", func(ctx context.Context) (any, error) {
+		return "hello", nil
+	}, WithType("llm"), WithModel("claude-sonnet"), WithProvider("anthropic"),
+		WithTokenUsage(TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 20}),
+		WithTemperature(1), WithCost(0.5))
+
+	spanData := exp.spanData(0)
+	if spanData["model"] != "claude-sonnet" || spanData["provider"] != "anthropic" {
+		t.Errorf("model/provider = %v/%v", spanData["model"], spanData["provider"])
+	}
+	if usage := spanData["usage"].(TokenUsage); usage.TotalTokens != 20 {
+		t.Errorf("explicit total_tokens should be kept, got %d", usage.TotalTokens)
+	}
+	if spanData["temperature"] != 1.0 || spanData["cost"] != 0.5 {
+		t.Errorf("temperature/cost = %v/%v", spanData["temperature"], spanData["cost"])
+	}
+}
+
+func TestPriceTable_ComputesCost(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithPricer(PriceTable{
+		"gpt-4o": {PromptPerMillion: 2.5, CompletionPerMillion: 10},
+	}))
+
+	_, priced := client.Start(context.Background(), "chat", "Priced", WithModel("gpt-4o"))
+	priced.SetTokenUsage(TokenUsage{PromptTokens: 1000, CompletionTokens: 500})
+	priced.End()
+
+	_, overridden := client.Start(context.Background(), "chat", "Overridden", WithModel("gpt-4o"))
+	overridden.SetTokenUsage(TokenUsage{PromptTokens: 1000, CompletionTokens: 500})
+	overridden.SetCost(1)
+	overridden.End()
+
+	_, unknown := client.Start(context.Background(), "chat", "Unknown", WithModel("other"))
+	unknown.SetTokenUsage(TokenUsage{PromptTokens: 1000})
+	unknown.End()
+
+	if cost := exp.spanData(0)["cost"].(float64); math.Abs(cost-0.0075) > 1e-12 {
+		t.Errorf("computed cost = %v, want 0.0075", cost)
+	}
+	if cost := exp.spanData(1)["cost"]; cost != 1.0 {
+		t.Errorf("explicit cost = %v, want 1", cost)
+	}
+	if _, ok := exp.spanData(2)["cost"]; ok {
+		t.Error("cost should be omitted for models missing from the price table")
+	}
+}
+
+func TestLLMSetters_NilReceiver(t *testing.T) {
+	var span *ActiveSpan
+	span.SetModel("m")
+	span.SetProvider("p")
+	span.SetTokenUsage(TokenUsage{})
+	span.SetTemperature(0)
+	span.SetCost(0)
+}
@@ -0,0 +1,83 @@
+package bitfab
+
+// Role is the author of a chat message.
+type Role string
+
+// Chat message roles.
+const (
+	RoleSystem    Role = "system"
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+	RoleTool      Role = "tool"
+)
+
+// Message is a chat message exchanged with an LLM, recorded in the canonical
+// shape the Bitfab UI renders. Plain text goes in Content; multimodal content
+// goes in Parts. Assistant messages that call tools list them in ToolCalls,
+// and the tool's reply is a RoleTool message whose ToolCallID matches the call.
+type Message struct {
+	Role       Role          `json:"role"`
+	Content    string        `json:"content,omitempty"`
+	Parts      []ContentPart `json:"parts,omitempty"`
+	Name       string        `json:"name,omitempty"`
+	ToolCalls  []ToolCall    `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+}
+
+// ContentPart is one part of a multimodal message. Type is "text" for text
+// parts and "image" for images; other types are passed through unchanged.
+type ContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	URL      string `json:"url,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+}
+
+// TextPart returns a text ContentPart.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart returns an image ContentPart referencing url, which may be a
+// data: URL.
+func ImagePart(url string) ContentPart {
+	return ContentPart{Type: "image", URL: url}
+}
+
+// ToolCall is a tool invocation requested by the model. Arguments holds the
+// decoded arguments, or the raw JSON string if the caller has not decoded them.
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+// WithInputMessages sets the chat messages sent to the model, recorded in
+// span_data.input_messages.
+func WithInputMessages(messages ...Message) SpanOption {
+	return func(c *spanConfig) { c.inputMessages = messages }
+}
+
+// SetInputMessages records the chat messages sent to the model in
+// span_data.input_messages. It coexists with SetPrompt and SetInput.
+// Calling it again replaces the previous messages.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetInputMessages(messages ...Message) {
+	defer func() { recover() }()
+	if s == nil {
+		return
+	}
+	s.inputMessages = messages
+}
+
+// SetOutputMessages records the messages returned by the model, including
+// any tool calls, in span_data.output_messages. Calling it again replaces the
+// previous messages.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetOutputMessages(messages ...Message) {
+	defer func() { recover() }()
+	if s == nil {
+		return
+	}
+	s.outputMessages = messages
+}
@@ -0,0 +1,76 @@
+package bitfab
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestMessages_RecordedAlongsidePrompt(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Completion", WithType("llm"),
+		WithInputMessages(
+			Message{Role: RoleSystem, Content: "You are a weather bot."},
+			Message{Role: RoleUser, Parts: []ContentPart{TextPart("What's this?"), ImagePart("https://example.com/sky.png")}},
+		))
+	span.SetPrompt("You are a weather bot.")
+	span.SetOutputMessages(Message{
+		Role:      RoleAssistant,
+		ToolCalls: []ToolCall{{ID: "call_1", Name: "get_weather", Arguments: map[string]any{"city": "Paris"}}},
+	})
+	span.End()
+
+	spanData := exp.spanData(0)
+	if spanData["prompt"] != "You are a weather bot." {
+		t.Errorf("prompt = %v, should coexist with messages", spanData["prompt"])
+	}
+	in, ok := spanData["input_messages"].([]Message)
+	if !ok || len(in) != 2 || in[0].Role != RoleSystem || in[1].Parts[1].Type != "image" {
+		t.Errorf("input_messages = %v", spanData["input_messages"])
+	}
+	out, ok := spanData["output_messages"].([]Message)
+	if !ok || len(out) != 1 || out[0].ToolCalls[0].Name != "get_weather" {
+		t.Errorf("output_messages = %v", spanData["output_messages"])
+	}
+}
+
+func TestMessages_OmittedWhenUnset(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Completion")
+	span.SetInputMessages()
+	span.End()
+
+	spanData := exp.spanData(0)
+	if _, ok := spanData["input_messages"]; ok {
+		t.Error("input_messages should be omitted when empty")
+	}
+	if _, ok := spanData["output_messages"]; ok {
+		t.Error("output_messages should be omitted when unset")
+	}
+}
+
+func TestMessage_JSONShape(t *testing.T) {
+	msgs := []Message{
+		{Role: RoleAssistant, ToolCalls: []ToolCall{{ID: "call_1", Name: "lookup", Arguments: `{"q":"x"}`}}},
+		{Role: RoleTool, ToolCallID: "call_1", Content: "42"},
+	}
+	b, err := json.Marshal(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"role":"assistant","tool_calls":[{"id":"call_1","name":"lookup","arguments":"{\"q\":\"x\"}"}]},` +
+		`{"role":"tool","content":"42","tool_call_id":"call_1"}]`
+	if string(b) != want {
+		t.Errorf("json = %s\nwant   %s", b, want)
+	}
+}
+
+func TestMessageSetters_NilReceiver(t *testing.T) {
+	var span *ActiveSpan
+	span.SetInputMessages(Message{Role: RoleUser})
+	span.SetOutputMessages(Message{Role: RoleAssistant})
+}
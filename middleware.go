@@ -0,0 +1,215 @@
+package bitfab
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// MiddlewareOption configures the span created by Client.Middleware.
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	spanName     func(r *http.Request) string
+	spanType     func(r *http.Request) string
+	maxBodyBytes int
+}
+
+// WithRouteSpanName sets how the span name is derived from the request.
+// Defaults to the method and path, e.g. "GET /orders/42".
+func WithRouteSpanName(fn func(r *http.Request) string) MiddlewareOption {
+	return func(c *middlewareConfig) { c.spanName = fn }
+}
+
+// WithRouteSpanType sets how the span type is derived from the request.
+// Defaults to "custom".
+func WithRouteSpanType(fn func(r *http.Request) string) MiddlewareOption {
+	return func(c *middlewareConfig) { c.spanType = fn }
+}
+
+// WithBodyCapture records request and response bodies as span input and
+// output, each truncated to maxBytes. Only the part of the request body that
+// the handler reads is recorded. Bodies are not captured by default.
+func WithBodyCapture(maxBytes int) MiddlewareOption {
+	return func(c *middlewareConfig) { c.maxBodyBytes = maxBytes }
+}
+
+// Middleware returns net/http middleware that traces every request in a span
+// under traceFunctionKey. Incoming W3C trace context is extracted, so requests
+// from instrumented services join the caller's trace.
+//
+// The span records the method, path, status code and latency. Responses with
+// a 5xx status are recorded as errors, as are handler panics, which are
+// re-raised after the span is sent. Otherwise the span is ended in the
+// background once the handler returns, so the response is not held up while
+// it is delivered. The request context passed to the next
+// handler carries the span, so GetCurrentTrace and nested spans work inside it.
+//
+// To configure routes differently, wrap each route's handler separately or
+// derive the span name and type from the request with WithRouteSpanName and
+// WithRouteSpanType.
+func (c *Client) Middleware(traceFunctionKey string, opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	cfg := middlewareConfig{
+		spanName: func(r *http.Request) string { return r.Method + " " + r.URL.Path },
+		spanType: func(r *http.Request) string { return "custom" },
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := ExtractTraceContext(r.Context(), r.Header)
+			ctx, span := c.Start(ctx, traceFunctionKey, cfg.spanName(r), WithType(cfg.spanType(r)))
+
+			var reqBody *limitedBuffer
+			if cfg.maxBodyBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+				reqBody = &limitedBuffer{max: cfg.maxBodyBytes}
+				r.Body = &teeReadCloser{ReadCloser: r.Body, w: reqBody}
+			}
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			if cfg.maxBodyBytes > 0 {
+				rec.body = &limitedBuffer{max: cfg.maxBodyBytes}
+			}
+
+			start := time.Now()
+			defer func() {
+				p := recover()
+				if p != nil {
+					span.RecordPanic(p)
+				}
+				latency := time.Since(start)
+
+				input := map[string]any{
+					"method": r.Method,
+					"url":    r.URL.String(),
+				}
+				if reqBody != nil {
+					input["body"] = reqBody.String()
+				}
+				span.SetInput(input)
+
+				output := map[string]any{"status_code": rec.status}
+				if rec.body != nil {
+					output["body"] = rec.body.String()
+				}
+				span.SetOutput(output)
+
+				span.AddContext(map[string]any{
+					"http.method":      r.Method,
+					"http.path":        r.URL.Path,
+					"http.status_code": rec.status,
+					"http.latency_ms":  latency.Milliseconds(),
+				})
+				if rec.status >= 500 {
+					span.SetError(fmt.Errorf("HTTP %d %s", rec.status, http.StatusText(rec.status)))
+				}
+
+				if p != nil {
+					span.End()
+					panic(p)
+				}
+				// The request's span is a local root, so End waits until it and
+				// its children are delivered. Keep that off the response path;
+				// Shutdown still waits for the trace.
+				go span.End()
+			}()
+
+			next.ServeHTTP(rec, r.WithContext(ctx))
+		})
+	}
+}
+
+// statusRecorder wraps an http.ResponseWriter to record the status code and,
+// optionally, the start of the response body.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        *limitedBuffer
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	if r.body != nil {
+		r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher when the underlying writer supports it.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer supports it, so
+// connection upgrades such as websockets work inside traced handlers.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("bitfab: response writer cannot be hijacked: %w", http.ErrNotSupported)
+	}
+	return h.Hijack()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// limitedBuffer keeps the first max bytes written to it and counts the rest.
+type limitedBuffer struct {
+	buf     bytes.Buffer
+	max     int
+	dropped int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		if len(p) <= room {
+			b.buf.Write(p)
+		} else {
+			b.buf.Write(p[:room])
+			b.dropped += len(p) - room
+		}
+	} else {
+		b.dropped += len(p)
+	}
+	return len(p), nil
+}
+
+// String returns the captured bytes, noting how many were cut off.
+func (b *limitedBuffer) String() string {
+	if b.dropped > 0 {
+		return fmt.Sprintf("%s...[truncated %d bytes]", b.buf.String(), b.dropped)
+	}
+	return b.buf.String()
+}
+
+// teeReadCloser copies everything read from the wrapped body into w.
+type teeReadCloser struct {
+	io.ReadCloser
+	w io.Writer
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.w.Write(p[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,234 @@
+package bitfab
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve runs a request through handler and waits for its span, which the
+// middleware ends in the background, to be exported.
+func serve(t *testing.T, client *Client, handler http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+	return rec
+}
+
+func TestMiddleware_RecordsRequest(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	var trace *CurrentTrace
+	handler := client.Middleware("api")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = GetCurrentTrace(r.Context())
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+
+	rec := serve(t, client, handler, httptest.NewRequest("POST", "/orders?id=7", nil))
+
+	if rec.Code != http.StatusCreated || rec.Body.String() != "created" {
+		t.Errorf("response = %d %q, want 201 created", rec.Code, rec.Body.String())
+	}
+	if trace == nil {
+		t.Error("handler context should carry the current trace")
+	}
+	if len(exp.spans) != 1 || len(exp.traces) != 1 {
+		t.Fatalf("exported %d spans and %d traces, want 1 and 1", len(exp.spans), len(exp.traces))
+	}
+
+	spanData := exp.spanData(0)
+	if spanData["name"] != "POST /orders" {
+		t.Errorf("name = %v, want 'POST /orders'", spanData["name"])
+	}
+	input := spanData["input"].(map[string]any)
+	if input["method"] != "POST" || input["url"] != "/orders?id=7" {
+		t.Errorf("input = %v", input)
+	}
+	if _, ok := input["body"]; ok {
+		t.Error("body should not be captured by default")
+	}
+	output := spanData["output"].(map[string]any)
+	if output["status_code"] != http.StatusCreated {
+		t.Errorf("status_code = %v, want 201", output["status_code"])
+	}
+	ctxEntry := spanData["contexts"].([]ContextEntry)[0]
+	if ctxEntry["http.status_code"] != http.StatusCreated || ctxEntry["http.path"] != "/orders" {
+		t.Errorf("context = %v", ctxEntry)
+	}
+	if _, ok := ctxEntry["http.latency_ms"]; !ok {
+		t.Error("latency should be recorded")
+	}
+	if _, ok := spanData["error"]; ok {
+		t.Error("2xx response should not be an error")
+	}
+}
+
+func TestMiddleware_ServerErrorIsSpanError(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	handler := client.Middleware("api")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusBadGateway)
+	}))
+	serve(t, client, handler, httptest.NewRequest("GET", "/", nil))
+
+	if got := exp.spanData(0)["error"]; got != "HTTP 502 Bad Gateway" {
+		t.Errorf("error = %v, want 'HTTP 502 Bad Gateway'", got)
+	}
+}
+
+func TestMiddleware_RouteNameTypeAndBodies(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	mw := client.Middleware("api",
+		WithRouteSpanName(func(r *http.Request) string { return "Chat" }),
+		WithRouteSpanType(func(r *http.Request) string { return "agent" }),
+		WithBodyCapture(5),
+	)
+	handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		w.Write([]byte("hello world"))
+	}))
+	serve(t, client, handler, httptest.NewRequest("POST", "/chat", strings.NewReader("abcdefgh")))
+
+	spanData := exp.spanData(0)
+	if spanData["name"] != "Chat" || spanData["type"] != "agent" {
+		t.Errorf("name/type = %v/%v, want Chat/agent", spanData["name"], spanData["type"])
+	}
+	if got := spanData["input"].(map[string]any)["body"]; got != "abcde...[truncated 3 bytes]" {
+		t.Errorf("request body = %q", got)
+	}
+	if got := spanData["output"].(map[string]any)["body"]; got != "hello...[truncated 6 bytes]" {
+		t.Errorf("response body = %q", got)
+	}
+}
+
+func TestMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	caller := pushSpan(context.Background(), spanEntry{
+		traceID: "4bf92f35-77b3-4da6-a3ce-929d0e0e4736",
+		spanID:  "0f8fad5b-d9cb-469f-a165-70867728950e",
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	InjectTraceContext(caller, req.Header)
+
+	handler := client.Middleware("api")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve(t, client, handler, req)
+
+	raw := rawSpanOf(exp.spans[0])
+	if raw["trace_id"] != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" || raw["parent_id"] != "0f8fad5b-d9cb-469f-a165-70867728950e" {
+		t.Errorf("span did not continue the incoming trace: %v", raw)
+	}
+	if len(exp.traces) != 0 {
+		t.Error("downstream request should not send trace completion")
+	}
+}
+
+func TestMiddleware_PanicIsRecordedAndReraised(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	handler := client.Middleware("api")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler exploded")
+	}))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "handler exploded" {
+				t.Errorf("recovered %v, want the handler's panic", r)
+			}
+		}()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+
+	spanData := exp.spanData(0)
+	if spanData["error"] != "panic: handler exploded" {
+		t.Errorf("error = %v, want 'panic: handler exploded'", spanData["error"])
+	}
+	if _, ok := spanData["panic"]; !ok {
+		t.Error("span should record the panic")
+	}
+	if len(exp.traces) != 1 {
+		t.Errorf("sent %d trace completions, want 1", len(exp.traces))
+	}
+}
+
+// slowExporter delivers each span after a delay.
+type slowExporter struct {
+	recordingExporter
+	delay time.Duration
+}
+
+func (e *slowExporter) ExportSpan(payload map[string]any) <-chan struct{} {
+	e.recordingExporter.ExportSpan(payload)
+	done := make(chan struct{})
+	time.AfterFunc(e.delay, func() { close(done) })
+	return done
+}
+
+func TestMiddleware_DoesNotWaitForDelivery(t *testing.T) {
+	exp := &slowExporter{delay: 300 * time.Millisecond}
+	client := NewClient("test-key", WithExporter(exp))
+	handler := client.Middleware("api")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if elapsed := time.Since(start); elapsed >= exp.delay {
+		t.Errorf("request took %v, should not wait for span delivery", elapsed)
+	}
+
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if len(exp.spans) != 1 || len(exp.traces) != 1 {
+		t.Errorf("exported %d spans and %d traces, want 1 and 1", len(exp.spans), len(exp.traces))
+	}
+}
+
+func TestMiddleware_SupportsHijack(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	defer client.Shutdown(context.Background())
+
+	server := httptest.NewServer(client.Middleware("api")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hj, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("wrapped response writer does not implement http.Hijacker")
+			return
+		}
+		conn, buf, err := hj.Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		buf.Flush()
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hijacked" {
+		t.Errorf("body = %q, want hijacked", body)
+	}
+}
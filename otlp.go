@@ -0,0 +1,419 @@
+package bitfab
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OTLP span kind and status codes, as defined by the OpenTelemetry protocol.
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeOK     = 1
+	otlpStatusCodeError  = 2
+)
+
+// OTLPExporter is an Exporter that sends spans to an OpenTelemetry collector
+// using OTLP/HTTP with JSON encoding.
+//
+// Each span is converted to an OTLP span: Bitfab trace and span UUIDs become
+// 16- and 8-byte OTLP IDs, and the span type, traceFunctionKey, function name,
+// input, output, prompt, chat messages, contexts, error and error info are
+// recorded as attributes under the "bitfab." prefix. LLM model, provider,
+// token usage and temperature use the OpenTelemetry "gen_ai." attributes, and
+// span events and links become OTLP span events and links. OTLP has no
+// notion of trace completion, so ExportTrace is a no-op.
+//
+// Spans are queued and sent in batches of up to MaxBatchSize spans per
+// request, when FlushInterval elapses or a trace's local root span ends.
+// Failed requests are retried according to the exporter's RetryPolicy.
+type OTLPExporter struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	client      *http.Client
+	batch       BatchOptions
+	retry       RetryPolicy
+	batcher     *spanBatcher
+	wg          sync.WaitGroup
+	stats       deliveryStats
+	closeMu     sync.RWMutex
+	closed      bool
+}
+
+// OTLPOption configures an OTLPExporter.
+type OTLPOption func(*OTLPExporter)
+
+// WithOTLPHeaders sets extra HTTP headers sent with every export request,
+// such as collector authentication.
+func WithOTLPHeaders(headers map[string]string) OTLPOption {
+	return func(e *OTLPExporter) { e.headers = headers }
+}
+
+// WithOTLPServiceName sets the service.name resource attribute. Defaults to
+// "bitfab-go".
+func WithOTLPServiceName(name string) OTLPOption {
+	return func(e *OTLPExporter) { e.serviceName = name }
+}
+
+// WithOTLPHTTPClient sets the HTTP client used for export requests.
+func WithOTLPHTTPClient(client *http.Client) OTLPOption {
+	return func(e *OTLPExporter) { e.client = client }
+}
+
+// WithOTLPBatching sets how spans are batched into export requests. Zero
+// fields in opts use the package defaults.
+func WithOTLPBatching(opts BatchOptions) OTLPOption {
+	return func(e *OTLPExporter) { e.batch = opts }
+}
+
+// WithOTLPRetryPolicy sets the retry policy for export requests. Zero fields
+// in policy use the package defaults.
+func WithOTLPRetryPolicy(policy RetryPolicy) OTLPOption {
+	return func(e *OTLPExporter) { e.retry = policy }
+}
+
+// NewOTLPExporter creates an OTLPExporter that posts to endpoint, the full
+// URL of the collector's traces endpoint (e.g. "http://localhost:4318/v1/traces").
+func NewOTLPExporter(endpoint string, opts ...OTLPOption) *OTLPExporter {
+	e := &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: "bitfab-go",
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	e.retry = e.retry.withDefaults()
+	e.batcher = newSpanBatcher(e.batch, &e.wg, &e.stats, 0, e.deliverBatch)
+	return e
+}
+
+// ExportSpan implements Exporter. The span is queued and sent with the next
+// batch.
+func (e *OTLPExporter) ExportSpan(payload map[string]any) <-chan struct{} {
+	e.closeMu.RLock()
+	defer e.closeMu.RUnlock()
+	if e.closed {
+		e.stats.spansDropped.Add(1)
+		done := make(chan struct{})
+		close(done)
+		return done
+	}
+	return e.batcher.enqueue(payload)
+}
+
+// ExportTrace implements Exporter. OTLP has no trace completion message, so
+// the payload is ignored.
+func (e *OTLPExporter) ExportTrace(payload map[string]any) {}
+
+// Flush implements Exporter.
+func (e *OTLPExporter) Flush(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		e.batcher.flush()
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+// flushQueue starts sending queued spans without waiting for them.
+func (e *OTLPExporter) flushQueue() {
+	e.batcher.flushSoon()
+}
+
+// Shutdown implements Exporter.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.closeMu.Lock()
+	e.closed = true
+	e.closeMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		e.batcher.stop()
+		e.wg.Wait()
+		close(done)
+	}()
+
+	var ctxErr error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+
+	spans := e.stats.spansDropped.Load()
+	if ctxErr != nil {
+		spans += e.stats.spansPending.Load()
+	}
+	if spans == 0 && ctxErr == nil {
+		return nil
+	}
+	return &ShutdownError{DroppedSpans: int(spans), Err: ctxErr}
+}
+
+// deliverBatch converts a batch of queued spans and sends them in a single
+// export request.
+func (e *OTLPExporter) deliverBatch(batch []queuedSpan) {
+	defer e.stats.spansPending.Add(-int64(len(batch)))
+	defer func() {
+		for _, item := range batch {
+			close(item.done)
+		}
+	}()
+	defer func() {
+		if r := recover(); r != nil {
+			func() {
+				defer func() { recover() }()
+				log.Printf("bitfab: panic in background request: %v", r)
+			}()
+		}
+	}()
+
+	// Convert spans individually so one malformed span does not prevent the
+	// rest of the batch from being delivered.
+	spans := make([]any, 0, len(batch))
+	for _, item := range batch {
+		span, err := otlpSpanFromPayload(item.payload)
+		if err != nil {
+			e.stats.spansDropped.Add(1)
+			log.Printf("bitfab: failed to export OTLP span: %v", err)
+			continue
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) == 0 {
+		return
+	}
+	if err := e.send(spans); err != nil {
+		e.stats.spansDropped.Add(int64(len(spans)))
+		log.Printf("bitfab: failed to export %d OTLP spans: %v", len(spans), err)
+	}
+}
+
+// send posts spans to the collector, retrying transient failures according
+// to the exporter's RetryPolicy.
+func (e *OTLPExporter) send(spans []any) error {
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{
+			map[string]any{
+				"resource": map[string]any{
+					"attributes": otlpAttributes(map[string]any{"service.name": e.serviceName}),
+				},
+				"scopeSpans": []any{
+					map[string]any{
+						"scope": map[string]any{"name": "bitfab-go", "version": Version},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("bitfab: failed to marshal OTLP payload: %w", err)
+	}
+
+	_, err = doWithRetry(e.client, e.retry.requestConfig(), func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range e.headers {
+			req.Header.Set(k, v)
+		}
+		return req, nil
+	})
+	return err
+}
+
+// otlpSpanFromPayload converts an external span payload into an OTLP JSON span.
+func otlpSpanFromPayload(payload map[string]any) (map[string]any, error) {
+	rawSpan, ok := payload["rawSpan"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("bitfab: span payload has no rawSpan")
+	}
+	spanData, _ := rawSpan["span_data"].(map[string]any)
+
+	id, _ := rawSpan["id"].(string)
+	traceID, _ := rawSpan["trace_id"].(string)
+	startedAt, _ := rawSpan["started_at"].(string)
+	endedAt, _ := rawSpan["ended_at"].(string)
+	name, _ := spanData["name"].(string)
+
+	attrs := map[string]any{}
+	if key, ok := payload["traceFunctionKey"].(string); ok {
+		attrs["bitfab.trace_function_key"] = key
+	}
+	for _, field := range []string{"type", "function_name", "input", "output", "prompt", "input_messages", "output_messages", "contexts", "error", "error_info", "time_to_first_token_ms", "tokens_per_second"} {
+		if v, ok := spanData[field]; ok {
+			if field == "type" {
+				attrs["bitfab.span.type"] = v
+			} else {
+				attrs["bitfab."+field] = v
+			}
+		}
+	}
+
+	if status, ok := spanData["status"].(map[string]any); ok {
+		attrs["bitfab.status"] = status["code"]
+	}
+	// LLM fields follow the OpenTelemetry GenAI semantic conventions.
+	if model, ok := spanData["model"].(string); ok {
+		attrs["gen_ai.request.model"] = model
+	}
+	if provider, ok := spanData["provider"].(string); ok {
+		attrs["gen_ai.system"] = provider
+	}
+	if usage, ok := spanData["usage"].(TokenUsage); ok {
+		attrs["gen_ai.usage.input_tokens"] = usage.PromptTokens
+		attrs["gen_ai.usage.output_tokens"] = usage.CompletionTokens
+	}
+	if temperature, ok := spanData["temperature"].(float64); ok {
+		attrs["gen_ai.request.temperature"] = temperature
+	}
+	if cost, ok := spanData["cost"].(float64); ok {
+		attrs["bitfab.cost"] = cost
+	}
+
+	span := map[string]any{
+		"traceId":           otlpID(traceID, 16),
+		"spanId":            otlpID(id, 8),
+		"name":              name,
+		"kind":              otlpSpanKindInternal,
+		"startTimeUnixNano": otlpTimestamp(startedAt),
+		"endTimeUnixNano":   otlpTimestamp(endedAt),
+		"attributes":        otlpAttributes(attrs),
+	}
+	if parentID, ok := rawSpan["parent_id"].(string); ok && parentID != "" {
+		span["parentSpanId"] = otlpID(parentID, 8)
+	}
+	if links, ok := rawSpan["links"].([]Link); ok {
+		otlpLinks := make([]any, 0, len(links))
+		for _, l := range links {
+			otlpLinks = append(otlpLinks, map[string]any{
+				"traceId":    otlpID(l.TraceID, 16),
+				"spanId":     otlpID(l.SpanID, 8),
+				"attributes": otlpAttributes(l.Attributes),
+			})
+		}
+		span["links"] = otlpLinks
+	}
+	if dropped, ok := spanData["dropped_links"].(int); ok {
+		span["droppedLinksCount"] = dropped
+	}
+	if events, ok := spanData["events"].([]SpanEvent); ok {
+		otlpEvents := make([]any, 0, len(events))
+		for _, e := range events {
+			otlpEvents = append(otlpEvents, map[string]any{
+				"timeUnixNano": otlpTimestamp(e.Timestamp),
+				"name":         e.Name,
+				"attributes":   otlpAttributes(e.Attributes),
+			})
+		}
+		span["events"] = otlpEvents
+	}
+	span["status"] = otlpStatus(spanData)
+	return span, nil
+}
+
+// otlpStatus maps the span status onto OTLP's ok/error status. Cancelled
+// and timed out spans are errors; blocked spans completed as intended and
+// are ok. Payloads without a status fall back to the error field.
+func otlpStatus(spanData map[string]any) map[string]any {
+	status, _ := spanData["status"].(map[string]any)
+	code, _ := status["code"].(string)
+	description, _ := status["description"].(string)
+	if code == "" {
+		if errMsg, ok := spanData["error"].(string); ok {
+			return map[string]any{"code": otlpStatusCodeError, "message": errMsg}
+		}
+		return map[string]any{"code": otlpStatusCodeOK}
+	}
+
+	switch StatusCode(code) {
+	case StatusError, StatusCancelled, StatusTimeout:
+		return map[string]any{"code": otlpStatusCodeError, "message": description}
+	default:
+		out := map[string]any{"code": otlpStatusCodeOK}
+		if description != "" {
+			out["message"] = description
+		}
+		return out
+	}
+}
+
+// otlpID converts a Bitfab ID into a hex-encoded OTLP ID of n bytes. UUIDs
+// keep their leading hex digits so IDs remain recognizable across systems;
+// other IDs are hashed.
+func otlpID(id string, n int) string {
+	stripped := strings.ReplaceAll(id, "-", "")
+	if len(stripped) >= 2*n {
+		if _, err := hex.DecodeString(stripped[:2*n]); err == nil {
+			return strings.ToLower(stripped[:2*n])
+		}
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:n])
+}
+
+// otlpTimestamp converts a span timestamp into OTLP's decimal nanosecond string.
+func otlpTimestamp(ts string) string {
+	t, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// otlpAttributes converts a map into OTLP key/value attributes. Strings,
+// booleans and numbers keep their type; everything else is JSON-encoded.
+func otlpAttributes(attrs map[string]any) []any {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]any, 0, len(attrs))
+	for _, k := range keys {
+		out = append(out, map[string]any{"key": k, "value": otlpValue(attrs[k])})
+	}
+	return out
+}
+
+func otlpValue(v any) map[string]any {
+	switch val := v.(type) {
+	case string:
+		return map[string]any{"stringValue": val}
+	case bool:
+		return map[string]any{"boolValue": val}
+	case int:
+		return map[string]any{"intValue": strconv.FormatInt(int64(val), 10)}
+	case int64:
+		return map[string]any{"intValue": strconv.FormatInt(val, 10)}
+	case float64:
+		return map[string]any{"doubleValue": val}
+	default:
+		b, err := json.Marshal(val)
+		if err != nil {
+			return map[string]any{"stringValue": fmt.Sprintf("%v", val)}
+		}
+		return map[string]any{"stringValue": string(b)}
+	}
+}
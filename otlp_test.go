@@ -0,0 +1,318 @@
+package bitfab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// otlpCollector is a stand-in for an OpenTelemetry collector's OTLP/HTTP
+// traces endpoint.
+type otlpCollector struct {
+	*httptest.Server
+	mu      sync.Mutex
+	spans   []map[string]any
+	headers []http.Header
+}
+
+func newOTLPCollector(t *testing.T) *otlpCollector {
+	t.Helper()
+	c := &otlpCollector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		var req map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid OTLP JSON: %v", err)
+		}
+		c.mu.Lock()
+		c.headers = append(c.headers, r.Header.Clone())
+		for _, rs := range req["resourceSpans"].([]any) {
+			for _, ss := range rs.(map[string]any)["scopeSpans"].([]any) {
+				for _, sp := range ss.(map[string]any)["spans"].([]any) {
+					c.spans = append(c.spans, sp.(map[string]any))
+				}
+			}
+		}
+		c.mu.Unlock()
+		w.WriteHeader(200)
+		w.Write([]byte("{}"))
+	}))
+	return c
+}
+
+func otlpAttr(span map[string]any, key string) map[string]any {
+	for _, a := range span["attributes"].([]any) {
+		attr := a.(map[string]any)
+		if attr["key"] == key {
+			return attr["value"].(map[string]any)
+		}
+	}
+	return nil
+}
+
+func TestOTLPExporter_ExportsSpans(t *testing.T) {
+	collector := newOTLPCollector(t)
+	defer collector.Close()
+
+	exp := NewOTLPExporter(collector.URL+"/v1/traces",
+		WithOTLPServiceName("orders"), WithOTLPHeaders(map[string]string{"X-Token": "secret"}))
+	client := NewClient("", WithExporter(exp))
+	ctx := context.Background()
+
+	client.Span(ctx, "order-service", func(ctx context.Context) (any, error) {
+		_, err := client.Span(ctx, "order-service", func(ctx context.Context) (any, error) {
+			return nil, errors.New("card declined")
+		}, WithName("Charge"), WithType("function"))
+		return map[string]any{"status": "failed"}, err
+	}, WithName("ProcessOrder"), WithType("agent"), WithInput("order-1"))
+
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+
+	if len(collector.spans) != 2 {
+		t.Fatalf("expected 2 OTLP spans, got %d", len(collector.spans))
+	}
+	if len(collector.headers) != 1 {
+		t.Errorf("expected spans in 1 export request, got %d", len(collector.headers))
+	}
+	if collector.headers[0].Get("X-Token") != "secret" {
+		t.Error("custom header was not sent")
+	}
+
+	var root, child map[string]any
+	for _, sp := range collector.spans {
+		if sp["name"] == "ProcessOrder" {
+			root = sp
+		} else {
+			child = sp
+		}
+	}
+	if root == nil || child == nil {
+		t.Fatal("could not find root and child spans")
+	}
+
+	if len(root["traceId"].(string)) != 32 || len(root["spanId"].(string)) != 16 {
+		t.Errorf("invalid OTLP IDs: traceId=%v spanId=%v", root["traceId"], root["spanId"])
+	}
+	if child["traceId"] != root["traceId"] {
+		t.Error("child span should share the root's traceId")
+	}
+	if child["parentSpanId"] != root["spanId"] {
+		t.Errorf("child parentSpanId = %v, want %v", child["parentSpanId"], root["spanId"])
+	}
+	if _, ok := root["parentSpanId"]; ok {
+		t.Error("root span should not have parentSpanId")
+	}
+	if v := otlpAttr(root, "bitfab.span.type"); v == nil || v["stringValue"] != "agent" {
+		t.Errorf("bitfab.span.type = %v, want agent", v)
+	}
+	if v := otlpAttr(root, "bitfab.trace_function_key"); v == nil || v["stringValue"] != "order-service" {
+		t.Errorf("bitfab.trace_function_key = %v, want order-service", v)
+	}
+	if v := otlpAttr(root, "bitfab.input"); v == nil || v["stringValue"] != "order-1" {
+		t.Errorf("bitfab.input = %v, want order-1", v)
+	}
+	if v := otlpAttr(root, "bitfab.output"); v == nil || v["stringValue"] != `{"status":"failed"}` {
+		t.Errorf("bitfab.output = %v, want JSON-encoded output", v)
+	}
+
+	status := child["status"].(map[string]any)
+	if status["code"] != float64(otlpStatusCodeError) || status["message"] != "card declined" {
+		t.Errorf("child status = %v, want error with message", status)
+	}
+	start, end := root["startTimeUnixNano"].(string), root["endTimeUnixNano"].(string)
+	if start == "0" || end == "0" || start > end {
+		t.Errorf("invalid timestamps: start=%s end=%s", start, end)
+	}
+}
+
+func TestOTLPExporter_RetriesTransientFailures(t *testing.T) {
+	collector := newOTLPCollector(t)
+	defer collector.Close()
+	var attempts atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		collector.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer flaky.Close()
+
+	exp := NewOTLPExporter(flaky.URL+"/v1/traces",
+		WithOTLPRetryPolicy(RetryPolicy{InitialBackoff: time.Millisecond}))
+	exp.ExportSpan(map[string]any{"rawSpan": map[string]any{"id": "a", "trace_id": "b"}})
+	if err := exp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if attempts.Load() != 2 || len(collector.spans) != 1 {
+		t.Errorf("got %d attempts and %d spans, want the span delivered on the second attempt", attempts.Load(), len(collector.spans))
+	}
+}
+
+func TestOTLPExporter_ShutdownReportsFailures(t *testing.T) {
+	exp := NewOTLPExporter("http://127.0.0.1:1/v1/traces",
+		WithOTLPBatching(BatchOptions{FlushInterval: 10 * time.Millisecond}),
+		WithOTLPRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	<-exp.ExportSpan(map[string]any{"rawSpan": map[string]any{"id": "a", "trace_id": "b"}})
+
+	err := exp.Shutdown(context.Background())
+	var se *ShutdownError
+	if !errors.As(err, &se) || se.DroppedSpans != 1 {
+		t.Errorf("Shutdown = %v, want ShutdownError with 1 dropped span", err)
+	}
+}
+
+func TestOTLPID(t *testing.T) {
+	if got := otlpID("0f8fad5b-d9cb-469f-a165-70867728950e", 16); got != "0f8fad5bd9cb469fa16570867728950e" {
+		t.Errorf("trace ID = %q", got)
+	}
+	if got := otlpID("0f8fad5b-d9cb-469f-a165-70867728950e", 8); got != "0f8fad5bd9cb469f" {
+		t.Errorf("span ID = %q", got)
+	}
+	if got := otlpID("not-a-uuid", 8); len(got) != 16 {
+		t.Errorf("hashed span ID = %q, want 16 hex chars", got)
+	}
+}
+
+func TestOTLPTimestamp(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 0, 0, 123000000, time.UTC)
+	if got := otlpTimestamp("2024-05-01T10:00:00.123Z"); got != "1714557600123000000" {
+		t.Errorf("otlpTimestamp = %s, want %d", got, ts.UnixNano())
+	}
+}
+
+func TestOTLPSpanFromPayload_LLMAttributes(t *testing.T) {
+	span, err := otlpSpanFromPayload(map[string]any{
+		"rawSpan": map[string]any{
+			"id":       "0f8fad5b-d9cb-469f-a165-70867728950e",
+			"trace_id": "4bf92f35-77b3-4da6-a3ce-929d0e0e4736",
+			"span_data": map[string]any{
+				"name":        "Completion",
+				"type":        "llm",
+				"model":       "gpt-4o",
+				"provider":    "openai",
+				"usage":       TokenUsage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15},
+				"temperature": 0.7,
+				"cost":        0.25,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := map[string]map[string]any{
+		"gen_ai.request.model":       {"stringValue": "gpt-4o"},
+		"gen_ai.system":              {"stringValue": "openai"},
+		"gen_ai.usage.input_tokens":  {"intValue": "12"},
+		"gen_ai.usage.output_tokens": {"intValue": "3"},
+		"gen_ai.request.temperature": {"doubleValue": 0.7},
+		"bitfab.cost":                {"doubleValue": 0.25},
+	}
+	for key, want := range checks {
+		got := otlpAttr(span, key)
+		for k, v := range want {
+			if got == nil || got[k] != v {
+				t.Errorf("%s = %v, want %v", key, got, want)
+			}
+		}
+	}
+}
+
+func TestOTLPSpanFromPayload_Events(t *testing.T) {
+	span, err := otlpSpanFromPayload(map[string]any{
+		"rawSpan": map[string]any{
+			"id":       "0f8fad5b-d9cb-469f-a165-70867728950e",
+			"trace_id": "4bf92f35-77b3-4da6-a3ce-929d0e0e4736",
+			"span_data": map[string]any{
+				"name": "Work",
+				"events": []SpanEvent{
+					{Name: "retry", Timestamp: "2024-01-01T00:00:00.250Z", Attributes: map[string]any{"attempt": 2}},
+				},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, ok := span["events"].([]any)
+	if !ok || len(events) != 1 {
+		t.Fatalf("events = %v", span["events"])
+	}
+	event := events[0].(map[string]any)
+	if event["name"] != "retry" || event["timeUnixNano"] != "1704067200250000000" {
+		t.Errorf("event = %v", event)
+	}
+	if attr := otlpAttr(event, "attempt"); attr == nil || attr["intValue"] != "2" {
+		t.Errorf("attempt attribute = %v", attr)
+	}
+}
+
+func TestOTLPSpanFromPayload_Links(t *testing.T) {
+	span, err := otlpSpanFromPayload(map[string]any{
+		"rawSpan": map[string]any{
+			"id":        "0f8fad5b-d9cb-469f-a165-70867728950e",
+			"trace_id":  "4bf92f35-77b3-4da6-a3ce-929d0e0e4736",
+			"span_data": map[string]any{"name": "Job"},
+			"links": []Link{{
+				TraceID:    "11111111-2222-3333-4444-555555555555",
+				SpanID:     "66666666-7777-8888-9999-aaaaaaaaaaaa",
+				Attributes: map[string]any{"queue": "emails"},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links, ok := span["links"].([]any)
+	if !ok || len(links) != 1 {
+		t.Fatalf("links = %v", span["links"])
+	}
+	link := links[0].(map[string]any)
+	if link["traceId"] != "11111111222233334444555555555555" || link["spanId"] != "6666666677778888" {
+		t.Errorf("link = %v", link)
+	}
+	if attr := otlpAttr(link, "queue"); attr == nil || attr["stringValue"] != "emails" {
+		t.Errorf("queue attribute = %v", attr)
+	}
+}
+
+func TestOTLPStatus(t *testing.T) {
+	tests := []struct {
+		spanData map[string]any
+		code     int
+		message  string
+	}{
+		{map[string]any{"status": map[string]any{"code": "ok"}}, otlpStatusCodeOK, ""},
+		{map[string]any{"status": map[string]any{"code": "blocked", "description": "pii"}}, otlpStatusCodeOK, "pii"},
+		{map[string]any{"status": map[string]any{"code": "timeout", "description": "deadline"}}, otlpStatusCodeError, "deadline"},
+		{map[string]any{"status": map[string]any{"code": "cancelled"}}, otlpStatusCodeError, ""},
+		{map[string]any{"error": "boom"}, otlpStatusCodeError, "boom"},
+		{map[string]any{}, otlpStatusCodeOK, ""},
+	}
+	for _, tt := range tests {
+		got := otlpStatus(tt.spanData)
+		msg, _ := got["message"].(string)
+		if got["code"] != tt.code || msg != tt.message {
+			t.Errorf("otlpStatus(%v) = %v, want code %d message %q", tt.spanData, got, tt.code, tt.message)
+		}
+	}
+}
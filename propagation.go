@@ -0,0 +1,146 @@
+package bitfab
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// W3C Trace Context header names.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// tracestateKey is the Bitfab entry in the tracestate header. Its value is
+// the full span UUID without dashes, since traceparent only carries the
+// first 8 bytes of it.
+const tracestateKey = "bitfab"
+
+// InjectTraceContext writes the current span in ctx to h as W3C traceparent
+// and tracestate headers, so a downstream service can continue the trace with
+// ExtractTraceContext. Other vendors' tracestate entries already in h are
+// preserved. It does nothing if ctx has no span.
+func InjectTraceContext(ctx context.Context, h http.Header) {
+	defer func() { recover() }() // Never crash the host app
+	entry := currentSpan(ctx)
+	if entry == nil || h == nil {
+		return
+	}
+	traceID, err := uuid.Parse(entry.traceID)
+	if err != nil {
+		return
+	}
+
+	// Only fully sampled traces are marked sampled; traces buffered until an
+	// error occurs are not, since the decision is not known yet.
+	flags := "00"
+	if entry.sampling == DecisionSample {
+		flags = "01"
+	}
+	h.Set(TraceparentHeader, fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(traceID[:]), otlpID(entry.spanID, 8), flags))
+
+	// The Bitfab entry tells the downstream service to follow the sampled
+	// flag. A remote context forwarded without a decision of ours does not
+	// carry it.
+	var state []string
+	if !entry.foreign() {
+		state = append(state, tracestateKey+"="+strings.ReplaceAll(entry.spanID, "-", ""))
+	}
+	for _, member := range tracestateMembers(h.Get(TracestateHeader)) {
+		if !strings.HasPrefix(member, tracestateKey+"=") {
+			state = append(state, member)
+		}
+	}
+	if len(state) > 0 {
+		h.Set(TracestateHeader, strings.Join(state, ","))
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// ExtractTraceContext returns a copy of ctx that continues the trace described
+// by the traceparent and tracestate headers in h. Spans started from the
+// returned context join the remote trace as children of the remote span.
+//
+// If the caller was instrumented with this SDK, identified by its entry in
+// tracestate, spans follow the caller's sampling decision from the
+// traceparent sampled flag, and the first span is the local root of the trace
+// in this service: it waits for its own children to be delivered, but the
+// trace completion is left to the service that started the trace.
+//
+// Otherwise the traceparent may come from a proxy, service mesh or gateway
+// that does not record spans itself, so the client's own Sampler decides when
+// the first span starts, and that span sends the trace completion as a root
+// span would. If h has no valid traceparent, ctx is returned unchanged and
+// spans start a new trace.
+func ExtractTraceContext(ctx context.Context, h http.Header) context.Context {
+	defer func() { recover() }() // Never crash the host app
+	if h == nil {
+		return ctx
+	}
+	traceID, parentID, sampled, ok := parseTraceparent(h.Get(TraceparentHeader))
+	if !ok {
+		return ctx
+	}
+
+	// Prefer the full Bitfab span ID when the caller was instrumented with
+	// this SDK; otherwise use the W3C parent ID as is.
+	fromBitfab := false
+	for _, member := range tracestateMembers(h.Get(TracestateHeader)) {
+		if v, found := strings.CutPrefix(member, tracestateKey+"="); found {
+			if id, err := uuid.Parse(v); err == nil && otlpID(id.String(), 8) == parentID {
+				parentID = id.String()
+				fromBitfab = true
+			}
+			break
+		}
+	}
+
+	sampling := DecisionSample
+	if !sampled {
+		sampling = DecisionDrop
+	}
+	return pushSpan(ctx, spanEntry{traceID: traceID, spanID: parentID, remote: true, sampling: sampling, fromBitfab: fromBitfab})
+}
+
+// parseTraceparent parses a version 00 traceparent header. The trace ID is
+// returned in UUID form so it matches trace IDs generated by this SDK.
+func parseTraceparent(header string) (traceID, parentID string, sampled, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", false, false
+	}
+	if parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return "", "", false, false
+	}
+	for _, p := range parts[:4] {
+		if _, err := hex.DecodeString(p); err != nil || strings.ToLower(p) != p {
+			return "", "", false, false
+		}
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", false, false
+	}
+	id, err := uuid.Parse(parts[1])
+	if err != nil {
+		return "", "", false, false
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	return id.String(), parts[2], flags[0]&0x01 == 1, true
+}
+
+// tracestateMembers splits a tracestate header into its list members.
+func tracestateMembers(header string) []string {
+	var members []string
+	for _, m := range strings.Split(header, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			members = append(members, m)
+		}
+	}
+	return members
+}
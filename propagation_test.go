@@ -0,0 +1,184 @@
+package bitfab
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func rawSpanOf(payload map[string]any) map[string]any {
+	return payload["rawSpan"].(map[string]any)
+}
+
+func TestInjectTraceContext_NoSpan(t *testing.T) {
+	h := http.Header{}
+	InjectTraceContext(context.Background(), h)
+	if h.Get(TraceparentHeader) != "" {
+		t.Errorf("traceparent = %q, want empty outside a span", h.Get(TraceparentHeader))
+	}
+}
+
+func TestTraceContext_RoundTripAcrossServices(t *testing.T) {
+	upstreamExp := &recordingExporter{}
+	upstream := NewClient("test-key", WithExporter(upstreamExp))
+	downstreamExp := &recordingExporter{}
+	downstream := NewClient("test-key", WithExporter(downstreamExp))
+
+	ctx, root := upstream.Start(context.Background(), "gateway", "HandleRequest")
+	h := http.Header{}
+	InjectTraceContext(ctx, h)
+
+	parts := strings.Split(h.Get(TraceparentHeader), "-")
+	if len(parts) != 4 || parts[0] != "00" || parts[1] != strings.ReplaceAll(root.traceID, "-", "") || parts[3] != "01" {
+		t.Fatalf("unexpected traceparent %q", h.Get(TraceparentHeader))
+	}
+
+	// Downstream service receives the request.
+	remoteCtx := ExtractTraceContext(context.Background(), h)
+	if GetCurrentTrace(remoteCtx) == nil {
+		t.Fatal("extracted context should carry the remote trace")
+	}
+	dctx, handler := downstream.Start(remoteCtx, "worker", "Work")
+	_, inner := downstream.Start(dctx, "worker", "Inner")
+	inner.End()
+	handler.End()
+
+	root.End()
+
+	downstreamExp.mu.Lock()
+	defer downstreamExp.mu.Unlock()
+	upstreamExp.mu.Lock()
+	defer upstreamExp.mu.Unlock()
+
+	if len(downstreamExp.spans) != 2 {
+		t.Fatalf("downstream exported %d spans, want 2", len(downstreamExp.spans))
+	}
+	innerRaw, handlerRaw := rawSpanOf(downstreamExp.spans[0]), rawSpanOf(downstreamExp.spans[1])
+	if handlerRaw["trace_id"] != root.traceID || innerRaw["trace_id"] != root.traceID {
+		t.Errorf("downstream spans should join trace %s", root.traceID)
+	}
+	if handlerRaw["parent_id"] != root.spanID {
+		t.Errorf("downstream local root parent_id = %v, want upstream span %s", handlerRaw["parent_id"], root.spanID)
+	}
+	if innerRaw["parent_id"] != handlerRaw["id"] {
+		t.Errorf("inner parent_id = %v, want %v", innerRaw["parent_id"], handlerRaw["id"])
+	}
+	if len(downstreamExp.traces) != 0 {
+		t.Errorf("downstream sent %d trace completions, want 0", len(downstreamExp.traces))
+	}
+	if len(upstreamExp.traces) != 1 {
+		t.Errorf("upstream sent %d trace completions, want 1", len(upstreamExp.traces))
+	}
+	if traceStateOf(upstream, root.traceID) != nil || traceStateOf(downstream, root.traceID) != nil {
+		t.Error("trace state should be cleaned up after both services finish")
+	}
+}
+
+func TestExtractTraceContext_ForeignParent(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(TracestateHeader, "vendor=abc")
+
+	_, span := client.Start(ExtractTraceContext(context.Background(), h), "worker", "Work")
+	span.End()
+
+	raw := rawSpanOf(exp.spans[0])
+	if raw["trace_id"] != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" {
+		t.Errorf("trace_id = %v", raw["trace_id"])
+	}
+	if raw["parent_id"] != "00f067aa0ba902b7" {
+		t.Errorf("parent_id = %v, want W3C parent id", raw["parent_id"])
+	}
+	// A proxy or gateway forwarding a traceparent sends no completion of its
+	// own, so the local root does.
+	if len(exp.traces) != 1 {
+		t.Fatalf("expected 1 trace completion for a foreign parent, got %d", len(exp.traces))
+	}
+	if id := exp.traces[0]["externalTrace"].(map[string]any)["id"]; id != raw["trace_id"] {
+		t.Errorf("trace completion id = %v, want %v", id, raw["trace_id"])
+	}
+}
+
+func TestExtractTraceContext_InvalidHeaders(t *testing.T) {
+	invalid := []string{
+		"",
+		"garbage",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, v := range invalid {
+		h := http.Header{}
+		h.Set(TraceparentHeader, v)
+		if currentSpan(ExtractTraceContext(context.Background(), h)) != nil {
+			t.Errorf("traceparent %q should be ignored", v)
+		}
+	}
+}
+
+func TestInjectTraceContext_PreservesOtherTracestate(t *testing.T) {
+	ctx := pushSpan(context.Background(), spanEntry{
+		traceID: "4bf92f35-77b3-4da6-a3ce-929d0e0e4736",
+		spanID:  "0f8fad5b-d9cb-469f-a165-70867728950e",
+	})
+	h := http.Header{}
+	h.Set(TracestateHeader, "bitfab=old,vendor=abc")
+	InjectTraceContext(ctx, h)
+
+	if got := h.Get(TracestateHeader); got != "bitfab=0f8fad5bd9cb469fa16570867728950e,vendor=abc" {
+		t.Errorf("tracestate = %q", got)
+	}
+	if got := h.Get(TraceparentHeader); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-0f8fad5bd9cb469f-01" {
+		t.Errorf("traceparent = %q", got)
+	}
+}
+
+func TestExtractTraceContext_RejectedAfterShutdown(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown returned error: %v", err)
+	}
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := ExtractTraceContext(context.Background(), h)
+	_, span := client.Start(ctx, "test", "Downstream")
+	span.End()
+
+	client.pendingMu.Lock()
+	live := len(client.live)
+	client.pendingMu.Unlock()
+	if live != 0 {
+		t.Errorf("%d live traces after Shutdown, want 0", live)
+	}
+	exp.mu.Lock()
+	defer exp.mu.Unlock()
+	if len(exp.spans) != 0 {
+		t.Errorf("exported %d spans after Shutdown, want 0", len(exp.spans))
+	}
+}
+
+func TestInjectTraceContext_ForwardsForeignContextWithoutBitfabEntry(t *testing.T) {
+	in := http.Header{}
+	in.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	in.Set(TracestateHeader, "congo=t61rcWkgMzE")
+
+	out := http.Header{}
+	out.Set(TracestateHeader, "congo=t61rcWkgMzE")
+	InjectTraceContext(ExtractTraceContext(context.Background(), in), out)
+
+	if got := out.Get(TracestateHeader); got != "congo=t61rcWkgMzE" {
+		t.Errorf("tracestate = %q, want no bitfab entry for a decision this SDK did not make", got)
+	}
+	if got := out.Get(TraceparentHeader); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00" {
+		t.Errorf("traceparent = %q", got)
+	}
+}
@@ -0,0 +1,150 @@
+package bitfab
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultRedactionReplacement replaces redacted values when
+// RedactionOptions.Replacement is empty.
+const DefaultRedactionReplacement = "[REDACTED]"
+
+// DefaultDenyKeys are the key names redacted when RedactionOptions.DenyKeys
+// is nil.
+var DefaultDenyKeys = []string{
+	"password", "passwd", "secret", "client_secret", "token", "access_token",
+	"refresh_token", "id_token", "api_key", "apikey", "authorization",
+	"cookie", "set_cookie", "private_key", "credit_card", "card_number", "cvv", "ssn",
+}
+
+// Detector finds sensitive substrings in text. Each match of Pattern for
+// which Valid (if set) returns true is replaced by "[REDACTED:<Name>]".
+type Detector struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Valid   func(match string) bool
+}
+
+// DefaultDetectors returns detectors for email addresses, payment card
+// numbers, bearer tokens, JWTs, AWS access key IDs and "sk-" style API keys.
+// They are used when RedactionOptions.Detectors is nil.
+func DefaultDetectors() []Detector {
+	return []Detector{
+		{Name: "email", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+		{Name: "card", Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), Valid: luhnValid},
+		{Name: "bearer", Pattern: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`)},
+		{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+		{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "api_key", Pattern: regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`)},
+	}
+}
+
+// RedactionOptions configures the redaction applied to span and trace data
+// before export. See WithRedaction.
+type RedactionOptions struct {
+	// DenyKeys lists map keys and struct field names whose values are
+	// replaced. Matching ignores case, "-" and "_", so "api_key" also
+	// matches "apiKey" and "API-KEY". Nil uses DefaultDenyKeys; an empty
+	// slice disables key matching.
+	DenyKeys []string
+	// Detectors are applied to every string. Nil uses DefaultDetectors; an
+	// empty slice disables detection.
+	Detectors []Detector
+	// Replacement replaces values of denied keys and fields tagged
+	// `bitfab:"redact"`. Defaults to DefaultRedactionReplacement.
+	Replacement string
+	// Hook, if set, is called for each field after the built-in redaction
+	// with the field name and the redacted value, and returns the value to
+	// export. Span fields are "input", "output", "prompt", "contexts",
+	// "input_messages", "output_messages", "events" (once per event's
+	// attributes), "links" (once per link's attributes) and "error" (error
+	// text, error info and panic); trace fields are "metadata" and "contexts".
+	Hook func(field string, value any) any
+}
+
+// WithRedaction redacts sensitive data from span inputs, outputs, prompts,
+// chat messages, contexts, event and link attributes and error text, and from
+// trace metadata and contexts, before anything is exported:
+//
+//	client := bitfab.NewClient(apiKey, bitfab.WithRedaction(bitfab.RedactionOptions{
+//	    DenyKeys: append(bitfab.DefaultDenyKeys, "date_of_birth"),
+//	}))
+//
+// Struct fields tagged `bitfab:"redact"` are always replaced. Redacted values
+// are exported in their JSON form (maps, slices and primitives), so the
+// original values passed to SetInput or SetOutput are never modified.
+func WithRedaction(opts RedactionOptions) Option {
+	return func(c *Client) {
+		r := &redactor{
+			replacement: opts.Replacement,
+			detectors:   opts.Detectors,
+			hook:        opts.Hook,
+			deny:        map[string]bool{},
+		}
+		if r.replacement == "" {
+			r.replacement = DefaultRedactionReplacement
+		}
+		if r.detectors == nil {
+			r.detectors = DefaultDetectors()
+		}
+		denyKeys := opts.DenyKeys
+		if denyKeys == nil {
+			denyKeys = DefaultDenyKeys
+		}
+		for _, k := range denyKeys {
+			r.deny[normalizeKey(k)] = true
+		}
+		c.sanitizer.redact = r
+	}
+}
+
+// redactor holds the redaction settings applied by the sanitizer.
+type redactor struct {
+	replacement string
+	deny        map[string]bool
+	detectors   []Detector
+	hook        func(field string, value any) any
+}
+
+// redactString replaces every detector match in s.
+func (r *redactor) redactString(s string) string {
+	for _, d := range r.detectors {
+		if d.Pattern == nil {
+			continue
+		}
+		s = d.Pattern.ReplaceAllStringFunc(s, func(match string) string {
+			if d.Valid != nil && !d.Valid(match) {
+				return match
+			}
+			return "[REDACTED:" + d.Name + "]"
+		})
+	}
+	return s
+}
+
+// normalizeKey lowercases k and removes "-" and "_" for deny list matching.
+func normalizeKey(k string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(k))
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum used by
+// payment card numbers.
+func luhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
@@ -0,0 +1,225 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type signupRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+	SSNLast4 string `json:"ssn_last4" bitfab:"redact"`
+	Note     string `json:"note,omitempty"`
+	internal string
+}
+
+func TestRedaction_InputOutputAndContexts(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{}))
+
+	client.Span(context.Background(), "signup", func(ctx context.Context) (any, error) {
+		span := GetCurrentSpan(ctx)
+		span.SetInput(signupRequest{Email: "ada@example.com", Password: "hunter2", SSNLast4: "1234", internal: "x"})
+		span.AddContext(map[string]any{"Authorization": "Bearer abc.def", "region": "eu"})
+		span.SetPrompt("card 4111 1111 1111 1111, key sk-abcdefghijklmnopqrstuvwx")
+		return map[string]any{"user": map[string]any{"api_key": "k", "id": 7}}, nil
+	})
+
+	spanData := exp.spanData(0)
+	input := spanData["input"].(map[string]any)
+	want := map[string]any{"email": "[REDACTED:email]", "password": "[REDACTED]", "ssn_last4": "[REDACTED]"}
+	if len(input) != len(want) {
+		t.Errorf("input = %v, want %v", input, want)
+	}
+	for k, v := range want {
+		if input[k] != v {
+			t.Errorf("input[%q] = %v, want %v", k, input[k], v)
+		}
+	}
+
+	user := spanData["output"].(map[string]any)["user"].(map[string]any)
+	if user["api_key"] != "[REDACTED]" || user["id"] != 7 {
+		t.Errorf("output user = %v", user)
+	}
+
+	ctxEntry := spanData["contexts"].([]any)[0].(map[string]any)
+	if ctxEntry["Authorization"] != "[REDACTED]" || ctxEntry["region"] != "eu" {
+		t.Errorf("context = %v", ctxEntry)
+	}
+
+	if got := spanData["prompt"]; got != "card [REDACTED:card], key [REDACTED:api_key]" {
+		t.Errorf("prompt = %q", got)
+	}
+}
+
+func TestRedaction_DoesNotModifyOriginals(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{}))
+
+	input := map[string]any{"password": "hunter2"}
+	client.Span(context.Background(), "login", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).SetInput(input)
+		return nil, nil
+	})
+
+	if input["password"] != "hunter2" {
+		t.Errorf("caller's input was modified: %v", input)
+	}
+	if got := exp.spanData(0)["input"].(map[string]any)["password"]; got != "[REDACTED]" {
+		t.Errorf("exported password = %v", got)
+	}
+}
+
+func TestRedaction_ErrorText(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{}))
+
+	client.Span(context.Background(), "notify", func(ctx context.Context) (any, error) {
+		return nil, errors.New("cannot send to ada@example.com")
+	})
+
+	spanData := exp.spanData(0)
+	if got := spanData["error"]; got != "cannot send to [REDACTED:email]" {
+		t.Errorf("error = %q", got)
+	}
+	if got := spanData["error_info"].(map[string]any)["message"]; got != "cannot send to [REDACTED:email]" {
+		t.Errorf("error_info message = %q", got)
+	}
+	if got := spanData["status"].(map[string]any)["description"]; got != "cannot send to [REDACTED:email]" {
+		t.Errorf("status description = %q", got)
+	}
+}
+
+func TestRedaction_EventAttributes(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{}))
+
+	client.Span(context.Background(), "fetch", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).AddEvent("retry", map[string]any{"token": "t", "attempt": 2})
+		return nil, nil
+	})
+
+	events := exp.spanData(0)["events"].([]SpanEvent)
+	if events[0].Name != "retry" || events[0].Attributes["token"] != "[REDACTED]" || events[0].Attributes["attempt"] != 2 {
+		t.Errorf("event = %+v", events[0])
+	}
+}
+
+func TestRedaction_LinkAttributes(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{}))
+
+	link := Link{TraceID: "t1", SpanID: "s1", Attributes: map[string]any{"api_key": "k", "queue": "emails", "email": "jane@example.com"}}
+	client.Span(context.Background(), "worker", func(ctx context.Context) (any, error) {
+		return nil, nil
+	}, WithLinks(link))
+
+	links := rawSpanOf(exp.spans[0])["links"].([]Link)
+	attrs := links[0].Attributes
+	if links[0].TraceID != "t1" || attrs["api_key"] != "[REDACTED]" || attrs["queue"] != "emails" || strings.Contains(attrs["email"].(string), "jane@") {
+		t.Errorf("link = %+v", links[0])
+	}
+	if link.Attributes["api_key"] != "k" {
+		t.Error("original link attributes were modified")
+	}
+}
+
+func TestRedaction_TraceMetadataAndContexts(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{}))
+
+	client.Span(context.Background(), "chat", func(ctx context.Context) (any, error) {
+		trace := GetCurrentTrace(ctx)
+		trace.SetMetadata(map[string]any{"user_email": "ada@example.com", "secret": "s"})
+		trace.AddContext(map[string]any{"cookie": "session=1"})
+		return nil, nil
+	})
+
+	rawTrace := exp.traces[0]["externalTrace"].(map[string]any)
+	md := rawTrace["metadata"].(map[string]any)
+	if md["user_email"] != "[REDACTED:email]" || md["secret"] != "[REDACTED]" {
+		t.Errorf("metadata = %v", md)
+	}
+	ctxEntry := rawTrace["contexts"].([]any)[0].(map[string]any)
+	if ctxEntry["cookie"] != "[REDACTED]" {
+		t.Errorf("context = %v", ctxEntry)
+	}
+}
+
+func TestRedaction_CustomOptions(t *testing.T) {
+	exp := &recordingExporter{}
+	var hooked []string
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{
+		DenyKeys:    []string{"customer-id"},
+		Detectors:   []Detector{{Name: "order", Pattern: regexp.MustCompile(`ORD-\d+`)}},
+		Replacement: "***",
+		Hook: func(field string, value any) any {
+			hooked = append(hooked, field)
+			if field == "output" {
+				return strings.ToUpper(value.(string))
+			}
+			return value
+		},
+	}))
+
+	client.Span(context.Background(), "lookup", func(ctx context.Context) (any, error) {
+		GetCurrentSpan(ctx).SetInput(map[string]any{"customerId": 42, "password": "kept", "email": "ada@example.com"})
+		return "found ORD-991", nil
+	})
+
+	spanData := exp.spanData(0)
+	input := spanData["input"].(map[string]any)
+	if input["customerId"] != "***" || input["password"] != "kept" || input["email"] != "ada@example.com" {
+		t.Errorf("input = %v", input)
+	}
+	if got := spanData["output"]; got != "FOUND [REDACTED:ORDER]" {
+		t.Errorf("output = %q", got)
+	}
+	if strings.Join(hooked, ",") != "input,output" {
+		t.Errorf("hook called for %v, want input and output", hooked)
+	}
+}
+
+func TestRedaction_PanickingHookFailsClosed(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithRedaction(RedactionOptions{
+		Hook: func(field string, value any) any { panic("hook bug") },
+	}))
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		return "sensitive", nil
+	})
+
+	if got := exp.spanData(0)["output"]; got != DefaultRedactionReplacement {
+		t.Errorf("output = %v, want %q", got, DefaultRedactionReplacement)
+	}
+}
+
+func TestRedaction_DisabledByDefault(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		return map[string]any{"password": "hunter2"}, nil
+	})
+
+	if got := exp.spanData(0)["output"].(map[string]any)["password"]; got != "hunter2" {
+		t.Errorf("password = %v, want it unredacted without WithRedaction", got)
+	}
+}
+
+func TestLuhnValid(t *testing.T) {
+	for s, want := range map[string]bool{
+		"4111 1111 1111 1111": true,
+		"4111-1111-1111-1112": false,
+		"1234567890123":       false,
+		"79927398713":         false, // valid checksum but too short for a card
+	} {
+		if got := luhnValid(s); got != want {
+			t.Errorf("luhnValid(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package bitfab
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default retry parameters used when a RetryPolicy field is left at zero.
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+	DefaultBackoffFactor  = 2.0
+	DefaultBackoffJitter  = 0.2
+	DefaultMaxRetryAfter  = 5 * time.Minute
+)
+
+// RetryPolicy controls how requests to the Bitfab API are retried.
+//
+// Only network errors and HTTP 408, 429 and 5xx responses are retried. The
+// delay before each retry grows exponentially from InitialBackoff by Multiplier,
+// is capped at MaxBackoff, and is randomized by Jitter. A Retry-After header
+// on the response overrides the computed delay and is waited out in full, up
+// to MaxRetryAfter; if it asks for more, the request gives up instead of
+// retrying early, and the payload is spooled when WithSpool is set.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the delay grows after each retry.
+	Multiplier float64
+	// Jitter is the fraction of each delay that is randomized, between 0 and 1.
+	// A jitter of 0.2 yields delays between 80% and 100% of the computed value.
+	// Zero uses DefaultBackoffJitter; a negative value disables jitter.
+	Jitter float64
+	// MaxRetryAfter caps the delay the server may request with Retry-After.
+	// Requests run in the background, so it is much larger than MaxBackoff.
+	MaxRetryAfter time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if p.MaxRetryAfter <= 0 {
+		p.MaxRetryAfter = DefaultMaxRetryAfter
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultBackoffFactor
+	}
+	switch {
+	case p.Jitter == 0:
+		p.Jitter = DefaultBackoffJitter
+	case p.Jitter < 0:
+		p.Jitter = 0
+	case p.Jitter > 1:
+		p.Jitter = 1
+	}
+	return p
+}
+
+// requestConfig returns the retry settings of p for a single request.
+func (p RetryPolicy) requestConfig() requestConfig {
+	return requestConfig{
+		maxRetries:    p.MaxAttempts,
+		retryDelay:    p.InitialBackoff,
+		maxRetryDelay: p.MaxBackoff,
+		multiplier:    p.Multiplier,
+		jitter:        p.Jitter,
+		maxRetryAfter: p.MaxRetryAfter,
+	}
+}
+
+// doWithRetry sends the request built by newRequest with client, retrying
+// transient failures according to cfg. newRequest is called once per attempt
+// so each attempt gets a fresh body. It returns the body of the first 2xx
+// response, or the last error once the request gives up.
+func doWithRetry(client *http.Client, cfg requestConfig, newRequest func() (*http.Request, error)) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt < cfg.maxRetries; attempt++ {
+		if attempt > 0 {
+			delay, ok := retryDelay(cfg, attempt, lastErr)
+			if !ok {
+				return nil, lastErr
+			}
+			time.Sleep(delay)
+		}
+
+		req, err := newRequest()
+		if err != nil {
+			return nil, fmt.Errorf("bitfab: failed to create request: %w", err)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			lastErr = &httpStatusError{
+				statusCode: resp.StatusCode,
+				body:       string(respBody),
+				retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			}
+			if !isRetryable(lastErr) {
+				return nil, lastErr
+			}
+			continue
+		}
+		return respBody, nil
+	}
+	return nil, lastErr
+}
+
+// httpStatusError is returned by doWithRetry for non-2xx responses.
+type httpStatusError struct {
+	statusCode int
+	body       string
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("bitfab: HTTP %d: %s", e.statusCode, e.body)
+}
+
+// isRetryable reports whether a failed request may succeed if sent again.
+// Errors reported by the API in the response body and HTTP statuses other
+// than 408, 429 and 5xx are permanent; everything else, including network
+// errors, is transient.
+func isRetryable(err error) bool {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return false
+	}
+	var se *httpStatusError
+	if errors.As(err, &se) {
+		return se.statusCode == http.StatusRequestTimeout ||
+			se.statusCode == http.StatusTooManyRequests ||
+			se.statusCode >= 500
+	}
+	return true
+}
+
+// retryDelay returns the delay before the given retry (1 for the first retry)
+// of a request that failed with err. A Retry-After from the server takes
+// precedence over the computed exponential delay. It returns false if the
+// server asked to wait longer than cfg.maxRetryAfter: the request then gives
+// up rather than retrying earlier than asked, and the payload can be spooled.
+func retryDelay(cfg requestConfig, retry int, err error) (time.Duration, bool) {
+	var se *httpStatusError
+	if errors.As(err, &se) && se.retryAfter > 0 {
+		if cfg.maxRetryAfter > 0 && se.retryAfter > cfg.maxRetryAfter {
+			return 0, false
+		}
+		return se.retryAfter, true
+	}
+	return backoff(cfg, retry), true
+}
+
+// backoff returns the exponential delay before the given retry (1 for the
+// first retry), capped at cfg.maxRetryDelay and randomized by cfg.jitter.
+func backoff(cfg requestConfig, retry int) time.Duration {
+	delay := float64(cfg.retryDelay) * math.Pow(cfg.multiplier, float64(retry-1))
+	if cfg.maxRetryDelay > 0 && delay > float64(cfg.maxRetryDelay) {
+		delay = float64(cfg.maxRetryDelay)
+	}
+	if cfg.jitter > 0 {
+		delay -= delay * cfg.jitter * rand.Float64()
+	}
+	return time.Duration(delay)
+}
+
+// parseRetryAfter parses a Retry-After header given either as a number of
+// seconds or as an HTTP date. It returns 0 if the header is absent or invalid.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -0,0 +1,197 @@
+package bitfab
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPClient_Request_DoesNotRetryClientErrors(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(400)
+		w.Write([]byte("bad payload"))
+	}))
+	defer server.Close()
+
+	hc := newHTTPClient("test-key", server.URL)
+	err := hc.request("/api/test", map[string]any{})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+}
+
+func TestHTTPClient_Request_RetriesTooManyRequests(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			w.WriteHeader(429)
+			return
+		}
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	}))
+	defer server.Close()
+
+	hc := newHTTPClient("test-key", server.URL)
+	hc.retry = RetryPolicy{MaxAttempts: 5, InitialBackoff: time.Millisecond}.withDefaults()
+	if err := hc.request("/api/test", map[string]any{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+func TestHTTPClient_Request_HonorsRetryAfter(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(503)
+			return
+		}
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	}))
+	defer server.Close()
+
+	hc := newHTTPClient("test-key", server.URL)
+	hc.retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}.withDefaults()
+
+	start := time.Now()
+	if err := hc.request("/api/test", map[string]any{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("retried after %v, want at least the 1s Retry-After delay", elapsed)
+	}
+}
+
+func TestBackoff_Exponential(t *testing.T) {
+	cfg := requestConfig{retryDelay: 100 * time.Millisecond, maxRetryDelay: time.Second, multiplier: 2}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := backoff(cfg, i+1); got != w {
+			t.Errorf("backoff(retry %d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestBackoff_Jitter(t *testing.T) {
+	cfg := requestConfig{retryDelay: 100 * time.Millisecond, maxRetryDelay: time.Second, multiplier: 2, jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		got := backoff(cfg, 2)
+		if got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("jittered backoff = %v, want within [100ms, 200ms]", got)
+		}
+	}
+}
+
+func TestRetryDelay_RetryAfter(t *testing.T) {
+	cfg := requestConfig{retryDelay: 100 * time.Millisecond, maxRetryDelay: 2 * time.Second, multiplier: 2, maxRetryAfter: time.Minute}
+	if got, ok := retryDelay(cfg, 1, &httpStatusError{statusCode: 429, retryAfter: 30 * time.Second}); !ok || got != 30*time.Second {
+		t.Errorf("retryDelay with Retry-After beyond MaxBackoff = (%v, %v), want (30s, true)", got, ok)
+	}
+	if _, ok := retryDelay(cfg, 1, &httpStatusError{statusCode: 503, retryAfter: time.Hour}); ok {
+		t.Error("retryDelay with Retry-After beyond MaxRetryAfter should give up")
+	}
+	if got, ok := retryDelay(cfg, 2, errors.New("connection refused")); !ok || got != 200*time.Millisecond {
+		t.Errorf("retryDelay without Retry-After = (%v, %v), want (200ms, true)", got, ok)
+	}
+}
+
+func TestHTTPClient_Request_GivesUpOnLongRetryAfter(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(503)
+	}))
+	defer server.Close()
+
+	hc := newHTTPClient("test-key", server.URL)
+	hc.retry = RetryPolicy{MaxAttempts: 3, MaxRetryAfter: time.Second}.withDefaults()
+
+	start := time.Now()
+	if err := hc.request("/api/test", map[string]any{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("attempts = %d, want 1", got)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("request took %v, should give up without waiting", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-1", 0},
+		{"soon", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-30 * time.Second).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.header, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errors.New("connection refused"), true},
+		{&httpStatusError{statusCode: 408}, true},
+		{&httpStatusError{statusCode: 429}, true},
+		{&httpStatusError{statusCode: 502}, true},
+		{&httpStatusError{statusCode: 400}, false},
+		{&httpStatusError{statusCode: 401}, false},
+		{&apiError{msg: "Unknown function"}, false},
+	}
+	for _, tt := range tests {
+		if got := isRetryable(tt.err); got != tt.want {
+			t.Errorf("isRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	client := NewClient("test-key", WithRetryPolicy(RetryPolicy{MaxAttempts: 7}))
+	got := client.exporter.(*httpClient).retry
+	if got.MaxAttempts != 7 {
+		t.Errorf("MaxAttempts = %d, want 7", got.MaxAttempts)
+	}
+	if got.InitialBackoff != DefaultInitialBackoff {
+		t.Errorf("InitialBackoff = %v, want default %v", got.InitialBackoff, DefaultInitialBackoff)
+	}
+	if got.MaxRetryAfter != DefaultMaxRetryAfter {
+		t.Errorf("MaxRetryAfter = %v, want default %v", got.MaxRetryAfter, DefaultMaxRetryAfter)
+	}
+	if got.Jitter != DefaultBackoffJitter {
+		t.Errorf("Jitter = %v, want default %v", got.Jitter, DefaultBackoffJitter)
+	}
+
+	disabled := RetryPolicy{Jitter: -1}.withDefaults()
+	if disabled.Jitter != 0 {
+		t.Errorf("negative Jitter = %v after defaults, want 0", disabled.Jitter)
+	}
+}
@@ -0,0 +1,141 @@
+package bitfab
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"log"
+	"math"
+)
+
+// SamplingDecision is a Sampler's verdict for a new trace.
+type SamplingDecision int
+
+const (
+	// DecisionSample exports every span of the trace.
+	DecisionSample SamplingDecision = iota
+	// DecisionDrop exports no spans of the trace. Spans still run their
+	// callbacks and propagate context, they are just not sent.
+	DecisionDrop
+	// DecisionSampleOnError buffers the trace's spans in memory and exports
+	// them when the local root ends, only if at least one span failed. The
+	// buffer is bounded by the TailSamplingOptions limits.
+	DecisionSampleOnError
+)
+
+// SamplingParameters describe the root span of a new trace.
+type SamplingParameters struct {
+	TraceID          string
+	TraceFunctionKey string
+	SpanName         string
+	SpanType         string
+}
+
+// Sampler decides whether a new trace is exported. It is consulted once per
+// trace, when its root span starts, and child spans inherit the decision.
+// Spans in other services that receive the trace context from this SDK follow
+// the traceparent sampled flag: traces sampled or dropped outright are
+// recorded consistently across services.
+//
+// Deferred decisions are local to the service that makes them, so such
+// traces may be partially sampled. Traces buffered by SampleErrors are
+// propagated as not sampled, so downstream spans are dropped even if the
+// trace is kept here; traces buffered by WithTailSampling are propagated as
+// sampled, so downstream spans are exported even if the trace is dropped here.
+type Sampler interface {
+	ShouldSample(p SamplingParameters) SamplingDecision
+}
+
+// SamplerFunc adapts a function to the Sampler interface.
+type SamplerFunc func(p SamplingParameters) SamplingDecision
+
+// ShouldSample implements Sampler.
+func (f SamplerFunc) ShouldSample(p SamplingParameters) SamplingDecision {
+	return f(p)
+}
+
+// RatioSampler samples the given fraction of traces, from 0 (none) to 1
+// (all). The decision is derived from the trace ID, so it is stable for a
+// given trace.
+func RatioSampler(ratio float64) Sampler {
+	return SamplerFunc(func(p SamplingParameters) SamplingDecision {
+		if sampledByRatio(p.TraceID, ratio) {
+			return DecisionSample
+		}
+		return DecisionDrop
+	})
+}
+
+// KeyRateSampler samples traces at a per-traceFunctionKey ratio. Traces whose
+// key is not in rates are decided by fallback, or sampled if fallback is nil.
+//
+//	bitfab.WithSampler(bitfab.KeyRateSampler(map[string]float64{
+//	    "health-check": 0,
+//	    "chat":         0.1,
+//	}, nil))
+func KeyRateSampler(rates map[string]float64, fallback Sampler) Sampler {
+	return SamplerFunc(func(p SamplingParameters) SamplingDecision {
+		if ratio, ok := rates[p.TraceFunctionKey]; ok {
+			if sampledByRatio(p.TraceID, ratio) {
+				return DecisionSample
+			}
+			return DecisionDrop
+		}
+		if fallback != nil {
+			return fallback.ShouldSample(p)
+		}
+		return DecisionSample
+	})
+}
+
+// SampleErrors wraps s so that traces it would drop are still exported if any
+// of their spans fail. Such traces are buffered in memory until their root
+// span ends. The buffering is per service: a downstream service receiving the
+// trace context sees the trace as not sampled.
+func SampleErrors(s Sampler) Sampler {
+	return SamplerFunc(func(p SamplingParameters) SamplingDecision {
+		if d := s.ShouldSample(p); d != DecisionDrop {
+			return d
+		}
+		return DecisionSampleOnError
+	})
+}
+
+// sampledByRatio compares the leading 8 bytes of the trace ID against ratio.
+func sampledByRatio(traceID string, ratio float64) bool {
+	if ratio >= 1 {
+		return true
+	}
+	if ratio <= 0 {
+		return false
+	}
+	b, err := hex.DecodeString(otlpID(traceID, 8))
+	if err != nil {
+		return true
+	}
+	return binary.BigEndian.Uint64(b) < uint64(ratio*math.MaxUint64)
+}
+
+// sample consults the client's sampler for a new trace. A missing or
+// panicking sampler samples the trace.
+func (c *Client) sample(p SamplingParameters) (decision SamplingDecision) {
+	if c.sampler == nil {
+		return DecisionSample
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			decision = DecisionSample
+			func() {
+				defer func() { recover() }()
+				log.Printf("bitfab: panic in sampler: %v", r)
+			}()
+		}
+	}()
+	return c.sampler.ShouldSample(p)
+}
+
+// deferredTrace buffers the spans of a trace until its local root ends and
+// the trace is kept or dropped.
+type deferredTrace struct {
+	payloads []map[string]any
+	failed   bool
+}
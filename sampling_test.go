@@ -0,0 +1,218 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func runNestedTrace(client *Client, key string, childErr error) {
+	client.Span(context.Background(), key, func(ctx context.Context) (any, error) {
+		client.Span(ctx, key, func(ctx context.Context) (any, error) {
+			return nil, childErr
+		}, WithName("Child"))
+		return "ok", nil
+	}, WithName("Root"))
+}
+
+func TestSampler_DropExportsNothing(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithSampler(RatioSampler(0)))
+
+	var traceID string
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		traceID = currentSpan(ctx).traceID
+		client.Span(ctx, "test", func(ctx context.Context) (any, error) { return nil, nil })
+		return nil, nil
+	})
+
+	if len(exp.spans) != 0 || len(exp.traces) != 0 {
+		t.Errorf("exported %d spans and %d traces, want none", len(exp.spans), len(exp.traces))
+	}
+	if traceStateOf(client, traceID) != nil {
+		t.Error("trace state should be cleaned up for dropped traces")
+	}
+	client.pendingMu.Lock()
+	defer client.pendingMu.Unlock()
+	if len(client.pendingSpans) != 0 || len(client.live) != 0 {
+		t.Errorf("pending spans = %d, live traces = %d, want none", len(client.pendingSpans), len(client.live))
+	}
+}
+
+func TestSampler_DropSkipsSanitizing(t *testing.T) {
+	exp := &recordingExporter{}
+	hooked := 0
+	client := NewClient("test-key", WithExporter(exp), WithSampler(RatioSampler(0)),
+		WithRedaction(RedactionOptions{Hook: func(field string, value any) any {
+			hooked++
+			return value
+		}}))
+
+	runNestedTrace(client, "test", errors.New("child failed"))
+
+	if hooked != 0 {
+		t.Errorf("redaction hook called %d times for a dropped trace, want 0", hooked)
+	}
+	if err := client.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown after a dropped trace returned error: %v", err)
+	}
+}
+
+func TestSampler_ChildrenInheritDecision(t *testing.T) {
+	exp := &recordingExporter{}
+	calls := 0
+	client := NewClient("test-key", WithExporter(exp), WithSampler(SamplerFunc(func(p SamplingParameters) SamplingDecision {
+		calls++
+		if p.SpanName != "Root" || p.TraceFunctionKey != "test" || p.TraceID == "" {
+			t.Errorf("unexpected sampling parameters %+v", p)
+		}
+		return DecisionSample
+	})))
+
+	runNestedTrace(client, "test", nil)
+
+	if calls != 1 {
+		t.Errorf("sampler consulted %d times, want once per trace", calls)
+	}
+	if len(exp.spans) != 2 || len(exp.traces) != 1 {
+		t.Errorf("exported %d spans and %d traces, want 2 and 1", len(exp.spans), len(exp.traces))
+	}
+}
+
+func TestRatioSampler(t *testing.T) {
+	s := RatioSampler(0.25)
+	sampled := 0
+	for i := 0; i < 4000; i++ {
+		id := uuid.New().String()
+		d := s.ShouldSample(SamplingParameters{TraceID: id})
+		if d != s.ShouldSample(SamplingParameters{TraceID: id}) {
+			t.Fatal("decision should be stable for a trace ID")
+		}
+		if d == DecisionSample {
+			sampled++
+		}
+	}
+	if sampled < 800 || sampled > 1200 {
+		t.Errorf("sampled %d of 4000 traces, want about 1000", sampled)
+	}
+	if RatioSampler(1).ShouldSample(SamplingParameters{TraceID: uuid.New().String()}) != DecisionSample {
+		t.Error("ratio 1 should sample every trace")
+	}
+}
+
+func TestKeyRateSampler(t *testing.T) {
+	s := KeyRateSampler(map[string]float64{"health": 0, "chat": 1}, RatioSampler(0))
+	id := uuid.New().String()
+
+	if s.ShouldSample(SamplingParameters{TraceID: id, TraceFunctionKey: "health"}) != DecisionDrop {
+		t.Error("health should be dropped")
+	}
+	if s.ShouldSample(SamplingParameters{TraceID: id, TraceFunctionKey: "chat"}) != DecisionSample {
+		t.Error("chat should be sampled")
+	}
+	if s.ShouldSample(SamplingParameters{TraceID: id, TraceFunctionKey: "other"}) != DecisionDrop {
+		t.Error("unlisted keys should use the fallback")
+	}
+	if KeyRateSampler(nil, nil).ShouldSample(SamplingParameters{TraceID: id}) != DecisionSample {
+		t.Error("unlisted keys should be sampled without a fallback")
+	}
+}
+
+func TestSampleErrors_ExportsFailedTraces(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithSampler(SampleErrors(RatioSampler(0))))
+
+	runNestedTrace(client, "test", nil)
+	if len(exp.spans) != 0 || len(exp.traces) != 0 {
+		t.Fatalf("successful trace exported %d spans and %d traces, want none", len(exp.spans), len(exp.traces))
+	}
+
+	runNestedTrace(client, "test", errors.New("child failed"))
+	if len(exp.spans) != 2 || len(exp.traces) != 1 {
+		t.Fatalf("failed trace exported %d spans and %d traces, want 2 and 1", len(exp.spans), len(exp.traces))
+	}
+	if exp.spanData(0)["name"] != "Child" || exp.spanData(1)["name"] != "Root" {
+		t.Errorf("buffered spans should be exported in completion order")
+	}
+
+	client.pendingMu.Lock()
+	defer client.pendingMu.Unlock()
+	if len(client.deferred) != 0 {
+		t.Errorf("%d deferred traces left, want none", len(client.deferred))
+	}
+}
+
+func TestSampleErrors_KeepsSampledTraces(t *testing.T) {
+	s := SampleErrors(RatioSampler(1))
+	if s.ShouldSample(SamplingParameters{TraceID: uuid.New().String()}) != DecisionSample {
+		t.Error("traces sampled by the wrapped sampler should stay sampled")
+	}
+}
+
+func TestSampler_PanicSamplesTrace(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithSampler(SamplerFunc(func(SamplingParameters) SamplingDecision {
+		panic("bad sampler")
+	})))
+
+	runNestedTrace(client, "test", nil)
+	if len(exp.spans) != 2 {
+		t.Errorf("exported %d spans, want 2", len(exp.spans))
+	}
+}
+
+func TestSampler_PropagatesAcrossServices(t *testing.T) {
+	upstream := NewClient("test-key", WithExporter(&recordingExporter{}), WithSampler(RatioSampler(0)))
+	downstreamExp := &recordingExporter{}
+	downstream := NewClient("test-key", WithExporter(downstreamExp))
+
+	ctx, root := upstream.Start(context.Background(), "gateway", "Handle")
+	h := http.Header{}
+	InjectTraceContext(ctx, h)
+	root.End()
+
+	if !strings.HasSuffix(h.Get(TraceparentHeader), "-00") {
+		t.Fatalf("traceparent = %q, want the sampled flag cleared", h.Get(TraceparentHeader))
+	}
+
+	_, span := downstream.Start(ExtractTraceContext(context.Background(), h), "worker", "Work")
+	span.End()
+	if len(downstreamExp.spans) != 0 {
+		t.Errorf("downstream exported %d spans of an unsampled trace", len(downstreamExp.spans))
+	}
+}
+
+func TestSampler_ForeignUnsampledParentUsesLocalSampler(t *testing.T) {
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+
+	// A gateway forwarding an unsampled traceparent must not silence a
+	// service that samples everything.
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	_, span := client.Start(ExtractTraceContext(context.Background(), h), "worker", "Work")
+	span.End()
+	if len(exp.spans) != 1 {
+		t.Errorf("exported %d spans, want 1", len(exp.spans))
+	}
+
+	calls := 0
+	dropExp := &recordingExporter{}
+	dropping := NewClient("test-key", WithExporter(dropExp), WithSampler(SamplerFunc(func(p SamplingParameters) SamplingDecision {
+		calls++
+		if p.TraceID != "4bf92f35-77b3-4da6-a3ce-929d0e0e4736" {
+			t.Errorf("sampler got trace ID %q, want the incoming one", p.TraceID)
+		}
+		return DecisionDrop
+	})))
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, span = dropping.Start(ExtractTraceContext(context.Background(), h), "worker", "Work")
+	span.End()
+	if calls != 1 || len(dropExp.spans) != 0 {
+		t.Errorf("sampler consulted %d times and %d spans exported, want 1 and 0", calls, len(dropExp.spans))
+	}
+}
@@ -0,0 +1,326 @@
+package bitfab
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// maxWalkDepth bounds how deep values are walked when no payload limits are
+// set, guarding against cyclic data structures.
+const maxWalkDepth = 64
+
+// sanitizedSpanFields are the user-provided span_data fields passed through
+// the sanitizer. Events are handled separately to keep their type.
+var sanitizedSpanFields = []string{"input", "output", "prompt", "contexts", "input_messages", "output_messages"}
+
+// sanitizer converts user-provided span and trace data into its JSON form
+// before export, applying redaction (WithRedaction) and payload limits
+// (WithPayloadLimits) in a single pass. The original values are never
+// modified.
+type sanitizer struct {
+	redact *redactor
+	limits *PayloadLimits
+}
+
+// enabled reports whether any sanitization is configured.
+func (s *sanitizer) enabled() bool {
+	return s.redact != nil || s.limits != nil
+}
+
+// field sanitizes one top-level field. If sanitization panics, the whole
+// value is replaced, so data is never exported unredacted.
+func (s *sanitizer) field(name string, v any) (out any) {
+	defer func() {
+		if p := recover(); p != nil {
+			out = "[omitted]"
+			if s.redact != nil {
+				out = s.redact.replacement
+			}
+			func() {
+				defer func() { recover() }()
+				log.Printf("bitfab: sanitizing %s failed: %v", name, p)
+			}()
+		}
+	}()
+	out = s.walk(reflect.ValueOf(v), 0)
+	if s.redact != nil && s.redact.hook != nil {
+		out = s.redact.hook(name, out)
+	}
+	if s.limits != nil {
+		out = s.limits.fit(out, s.limits.MaxFieldBytes)
+	}
+	return out
+}
+
+// sanitizeSpanData sanitizes the user-provided fields of a span in place,
+// and returns the span's links with sanitized attributes.
+func (s *sanitizer) sanitizeSpanData(spanData map[string]any, links []Link) []Link {
+	for _, key := range sanitizedSpanFields {
+		if v, ok := spanData[key]; ok {
+			spanData[key] = s.field(key, v)
+		}
+	}
+
+	if events, ok := spanData["events"].([]SpanEvent); ok {
+		spanData["events"] = s.events(events)
+	}
+	if len(links) > 0 {
+		links = s.links(links)
+	}
+
+	// Error text appears in several places; all of it is handled the same way.
+	for _, key := range []string{"error", "error_info", "panic"} {
+		if v, ok := spanData[key]; ok {
+			spanData[key] = s.field("error", v)
+		}
+	}
+	if status, ok := spanData["status"].(map[string]any); ok && status["description"] != nil {
+		spanData["status"] = map[string]any{
+			"code":        status["code"],
+			"description": s.field("error", status["description"]),
+		}
+	}
+
+	if s.limits != nil {
+		links = s.limits.fitSpan(spanData, links)
+	}
+	return links
+}
+
+// sanitizeTraceData sanitizes the metadata and contexts of a completed trace
+// in place.
+func (s *sanitizer) sanitizeTraceData(rawTrace map[string]any) {
+	for _, key := range []string{"metadata", "contexts"} {
+		if v, ok := rawTrace[key]; ok {
+			rawTrace[key] = s.field(key, v)
+		}
+	}
+}
+
+// events sanitizes event attributes. With payload limits, events beyond
+// MaxItems are dropped and counted in a final "truncated" event.
+func (s *sanitizer) events(events []SpanEvent) []SpanEvent {
+	kept := events
+	if s.limits != nil && len(events) > s.limits.MaxItems {
+		kept = events[:s.limits.MaxItems]
+	}
+	out := make([]SpanEvent, len(kept), len(kept)+1)
+	for i, e := range kept {
+		e.Attributes, _ = s.field("events", e.Attributes).(map[string]any)
+		out[i] = e
+	}
+	if len(kept) < len(events) {
+		out = append(out, SpanEvent{
+			Name:      "truncated",
+			Timestamp: events[len(events)-1].Timestamp,
+			Attributes: map[string]any{
+				"elided_events":   len(events) - len(kept),
+				"original_events": len(events),
+			},
+		})
+	}
+	return out
+}
+
+// links sanitizes link attributes.
+func (s *sanitizer) links(links []Link) []Link {
+	out := make([]Link, len(links))
+	for i, l := range links {
+		l.Attributes, _ = s.field("links", l.Attributes).(map[string]any)
+		out[i] = l
+	}
+	return out
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// walk converts v into maps, slices and primitives the way encoding/json
+// would encode it, redacting and truncating along the way.
+func (s *sanitizer) walk(v reflect.Value, depth int) any {
+	if !v.IsValid() {
+		return nil
+	}
+	if maxDepth := s.maxDepth(); depth > maxDepth {
+		if s.limits != nil {
+			return fmt.Sprintf("[truncated: nested deeper than %d levels]", maxDepth)
+		}
+		return s.redact.replacement
+	}
+
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil
+	}
+	if v.Kind() != reflect.Interface {
+		if v.Type().Implements(jsonMarshalerType) {
+			b, err := v.Interface().(json.Marshaler).MarshalJSON()
+			if err != nil {
+				return nil
+			}
+			var generic any
+			if err := json.Unmarshal(b, &generic); err != nil {
+				return nil
+			}
+			return s.walk(reflect.ValueOf(generic), depth)
+		}
+		if v.Type().Implements(textMarshalerType) {
+			b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return nil
+			}
+			return s.str(string(b))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return s.walk(v.Elem(), depth)
+	case reflect.String:
+		return s.str(v.String())
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return v.Interface()
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		return s.walkMap(v, depth)
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			// Encoded as base64, like encoding/json.
+			if s.limits != nil && v.Len() > s.limits.MaxStringBytes {
+				return fmt.Sprintf("[truncated: %d bytes of binary data]", v.Len())
+			}
+			return v.Interface()
+		}
+		fallthrough
+	case reflect.Array:
+		n := v.Len()
+		kept := n
+		if s.limits != nil && n > s.limits.MaxItems {
+			kept = s.limits.MaxItems
+		}
+		out := make([]any, kept, kept+1)
+		for i := range out {
+			out[i] = s.walk(v.Index(i), depth+1)
+		}
+		if kept < n {
+			out = append(out, fmt.Sprintf("...[truncated %d of %d items]", n-kept, n))
+		}
+		return out
+	case reflect.Struct:
+		out := map[string]any{}
+		s.walkStruct(v, out, depth)
+		return out
+	default:
+		// Channels, functions and complex numbers cannot be encoded as JSON.
+		return nil
+	}
+}
+
+// walkMap converts a map with keys formatted as strings. With payload limits,
+// only the first MaxItems keys in sorted order are kept.
+func (s *sanitizer) walkMap(v reflect.Value, depth int) map[string]any {
+	keys := make([]string, 0, v.Len())
+	values := make(map[string]reflect.Value, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key := fmt.Sprint(iter.Key().Interface())
+		keys = append(keys, key)
+		values[key] = iter.Value()
+	}
+
+	n := len(keys)
+	if s.limits != nil && n > s.limits.MaxItems {
+		sort.Strings(keys)
+		keys = keys[:s.limits.MaxItems]
+	}
+	out := make(map[string]any, len(keys)+1)
+	for _, key := range keys {
+		if s.redact != nil && s.redact.deny[normalizeKey(key)] {
+			out[key] = s.redact.replacement
+		} else {
+			out[key] = s.walk(values[key], depth+1)
+		}
+	}
+	if len(keys) < n {
+		out["..."] = fmt.Sprintf("[truncated %d of %d keys]", n-len(keys), n)
+	}
+	return out
+}
+
+// walkStruct adds the exported fields of struct v to out, following the
+// encoding/json field naming rules. Embedded structs without a JSON name are
+// flattened into out.
+func (s *sanitizer) walkStruct(v reflect.Value, out map[string]any, depth int) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fv := v.Field(i)
+
+		if f.Anonymous && name == "" {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				s.walkStruct(fv, out, depth)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		if strings.Contains(opts, "omitempty") && fv.IsZero() {
+			continue
+		}
+
+		if s.redact != nil && (f.Tag.Get("bitfab") == "redact" || s.redact.deny[normalizeKey(name)]) {
+			out[name] = s.redact.replacement
+			continue
+		}
+		out[name] = s.walk(fv, depth+1)
+	}
+}
+
+// str redacts and truncates a string.
+func (s *sanitizer) str(v string) string {
+	if s.redact != nil {
+		v = s.redact.redactString(v)
+	}
+	if s.limits != nil {
+		v = truncateString(v, s.limits.MaxStringBytes)
+	}
+	return v
+}
+
+func (s *sanitizer) maxDepth() int {
+	if s.limits != nil {
+		return s.limits.MaxDepth
+	}
+	return maxWalkDepth
+}
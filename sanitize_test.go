@@ -0,0 +1,94 @@
+package bitfab
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSanitizer_WalkFollowsJSONRules(t *testing.T) {
+	s := &sanitizer{redact: &redactor{replacement: "[REDACTED]", deny: map[string]bool{}}}
+
+	type node struct {
+		Name string `json:"name"`
+		Next *node  `json:"next,omitempty"`
+	}
+	cyclic := &node{Name: "a"}
+	cyclic.Next = cyclic
+
+	got := s.walk(reflect.ValueOf(struct {
+		Raw   []byte
+		Skip  string `json:"-"`
+		Fn    func()
+		Cycle *node
+	}{Raw: []byte("hi"), Skip: "x", Cycle: cyclic}), 0).(map[string]any)
+
+	if string(got["Raw"].([]byte)) != "hi" {
+		t.Errorf("Raw = %v", got["Raw"])
+	}
+	if _, ok := got["Skip"]; ok {
+		t.Error(`fields tagged json:"-" should be omitted`)
+	}
+	if got["Fn"] != nil {
+		t.Errorf("Fn = %v, want nil", got["Fn"])
+	}
+	depth := 0
+	for v, ok := got["Cycle"].(map[string]any); ok; v, ok = v["next"].(map[string]any) {
+		depth++
+	}
+	if depth == 0 || depth > maxWalkDepth {
+		t.Errorf("cycle walked %d levels, want it cut off below %d", depth, maxWalkDepth)
+	}
+}
+
+func TestSanitizer_MarshalersAndEmbeddedStructs(t *testing.T) {
+	s := &sanitizer{redact: &redactor{replacement: "[REDACTED]", deny: map[string]bool{"token": true}}}
+
+	type Base struct {
+		ID    int    `json:"id"`
+		Token string `json:"token"`
+	}
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	got := s.walk(reflect.ValueOf(struct {
+		Base
+		At    time.Time       `json:"at"`
+		Raw   json.RawMessage `json:"raw"`
+		Level *slog.Level     `json:"level"`
+	}{Base: Base{ID: 1, Token: "t"}, At: at, Raw: json.RawMessage(`{"token":"t","n":1}`)}), 0).(map[string]any)
+
+	if got["id"] != 1 || got["token"] != "[REDACTED]" {
+		t.Errorf("embedded fields = %v", got)
+	}
+	if got["at"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("at = %v, want the time's JSON form", got["at"])
+	}
+	if raw := got["raw"].(map[string]any); raw["token"] != "[REDACTED]" || raw["n"] != 1.0 {
+		t.Errorf("raw = %v", raw)
+	}
+	if got["level"] != nil {
+		t.Errorf("level = %v, want nil", got["level"])
+	}
+}
+
+func TestSanitizer_RedactionAndLimitsTogether(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp),
+		WithPayloadLimits(PayloadLimits{MaxStringBytes: 20}),
+		WithRedaction(RedactionOptions{}),
+	)
+
+	client.Span(context.Background(), "op", func(ctx context.Context) (any, error) {
+		return map[string]any{"note": "contact ada@example.com for access", "password": "hunter2"}, nil
+	})
+
+	output := exp.spanData(0)["output"].(map[string]any)
+	if got := output["note"]; got != "contact [REDACTED:em...[truncated 15 of 35 bytes]" {
+		t.Errorf("note = %q, want it redacted before truncation", got)
+	}
+	if output["password"] != "[REDACTED]" {
+		t.Errorf("password = %v", output["password"])
+	}
+}
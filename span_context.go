@@ -14,6 +14,28 @@ type spanStackKey struct{}
 type spanEntry struct {
 	traceID string
 	spanID  string
+	// localRootID is the span ID of the first span of this trace created in
+	// this process. Spans register their deliveries with their local root.
+	localRootID string
+	// remote is set for entries extracted from an incoming request; the span
+	// lives in another service.
+	remote bool
+	// sampling is the trace's sampling decision, inherited by child spans.
+	sampling SamplingDecision
+	// fromBitfab is set for remote entries whose caller was instrumented with
+	// this SDK, identified by its tracestate entry.
+	fromBitfab bool
+	// span is the in-progress span for entries created by this client, or nil
+	// for remote entries.
+	span *ActiveSpan
+}
+
+// foreign reports whether e was extracted from a request whose caller was not
+// instrumented with this SDK, such as a proxy or gateway that only forwards a
+// traceparent. Such a caller neither decided the trace's sampling nor sends
+// its completion, so the first local span does both.
+func (e *spanEntry) foreign() bool {
+	return e.remote && !e.fromBitfab
 }
 
 // currentSpan returns the top of the span stack from the context, or nil if empty.
@@ -28,10 +50,15 @@ func currentSpan(ctx context.Context) *spanEntry {
 
 // withSpanContext pushes a new span entry onto the context's span stack.
 func withSpanContext(ctx context.Context, traceID, spanID string) context.Context {
+	return pushSpan(ctx, spanEntry{traceID: traceID, spanID: spanID})
+}
+
+// pushSpan pushes entry onto the context's span stack.
+func pushSpan(ctx context.Context, entry spanEntry) context.Context {
 	stack, _ := ctx.Value(spanStackKey{}).([]spanEntry)
 	newStack := make([]spanEntry, len(stack)+1)
 	copy(newStack, stack)
-	newStack[len(stack)] = spanEntry{traceID: traceID, spanID: spanID}
+	newStack[len(stack)] = entry
 	return context.WithValue(ctx, spanStackKey{}, newStack)
 }
 
@@ -48,53 +75,21 @@ type TraceState struct {
 	mu        sync.Mutex
 }
 
-// traceStateStore is the global store for active trace states.
-var traceStateStore = struct {
-	sync.RWMutex
-	states map[string]*TraceState
-}{
-	states: make(map[string]*TraceState),
-}
-
-// getTraceState retrieves the trace state for a given trace ID.
-func getTraceState(traceID string) *TraceState {
-	traceStateStore.RLock()
-	defer traceStateStore.RUnlock()
-	return traceStateStore.states[traceID]
-}
-
-// createTraceState creates or retrieves the trace state for a given trace ID.
-func createTraceState(traceID string) *TraceState {
-	traceStateStore.Lock()
-	defer traceStateStore.Unlock()
-	if ts, ok := traceStateStore.states[traceID]; ok {
-		return ts
-	}
-	ts := &TraceState{
+// newTraceState creates the state of a trace starting now.
+func newTraceState(traceID string) *TraceState {
+	return &TraceState{
 		TraceID:   traceID,
 		StartedAt: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
 	}
-	traceStateStore.states[traceID] = ts
-	return ts
-}
-
-// deleteTraceState removes the trace state for a given trace ID.
-func deleteTraceState(traceID string) {
-	traceStateStore.Lock()
-	defer traceStateStore.Unlock()
-	delete(traceStateStore.states, traceID)
-}
-
-// clearAllTraceStates clears all trace states (for testing).
-func clearAllTraceStates() {
-	traceStateStore.Lock()
-	defer traceStateStore.Unlock()
-	traceStateStore.states = make(map[string]*TraceState)
 }
 
 // CurrentTrace provides a handle to the current active trace for setting trace-level context.
+// Its setters have no effect once the trace's local root span has ended or the
+// trace was evicted, so a stale handle cannot recreate trace state.
 type CurrentTrace struct {
-	traceID string
+	traceID     string
+	localRootID string
+	client      *Client
 }
 
 // SetSessionID sets the session ID for this trace.
@@ -106,9 +101,9 @@ func (ct *CurrentTrace) SetSessionID(sessionID string) {
 	if ct == nil || ct.traceID == "" {
 		return
 	}
-	ts := getTraceState(ct.traceID)
+	ts := ct.state()
 	if ts == nil {
-		ts = createTraceState(ct.traceID)
+		return
 	}
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -124,9 +119,9 @@ func (ct *CurrentTrace) SetMetadata(metadata map[string]any) {
 	if ct == nil || ct.traceID == "" || metadata == nil {
 		return
 	}
-	ts := getTraceState(ct.traceID)
+	ts := ct.state()
 	if ts == nil {
-		ts = createTraceState(ct.traceID)
+		return
 	}
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -147,9 +142,9 @@ func (ct *CurrentTrace) AddContext(context map[string]any) {
 	if ct == nil || ct.traceID == "" || context == nil {
 		return
 	}
-	ts := getTraceState(ct.traceID)
+	ts := ct.state()
 	if ts == nil {
-		ts = createTraceState(ct.traceID)
+		return
 	}
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -158,10 +153,40 @@ func (ct *CurrentTrace) AddContext(context map[string]any) {
 
 // GetCurrentTrace returns a handle to the current active trace from the context.
 // Returns nil if not inside a span context.
+//
+// Trace state is owned by the Client that started the trace's local root span,
+// so clients in the same process never share session IDs, metadata or contexts.
 func GetCurrentTrace(ctx context.Context) *CurrentTrace {
 	entry := currentSpan(ctx)
 	if entry == nil {
 		return nil
 	}
-	return &CurrentTrace{traceID: entry.traceID}
+	ct := &CurrentTrace{traceID: entry.traceID, localRootID: entry.localRootID}
+	if entry.span != nil {
+		ct.client = entry.span.client
+	}
+	return ct
+}
+
+// state returns the trace state, or nil if the trace is not open in a client.
+func (ct *CurrentTrace) state() *TraceState {
+	if ct.client == nil {
+		return nil
+	}
+	return ct.client.traceState(ct.localRootID)
+}
+
+// GetCurrentSpan returns the innermost in-progress span from the context, so
+// code running inside a Span closure can record on it:
+//
+//	bitfab.GetCurrentSpan(ctx).AddEvent("cache_hit", map[string]any{"key": key})
+//
+// Returns nil if ctx has no span or the span belongs to a remote service.
+// All ActiveSpan methods are safe to call on nil.
+func GetCurrentSpan(ctx context.Context) *ActiveSpan {
+	entry := currentSpan(ctx)
+	if entry == nil {
+		return nil
+	}
+	return entry.span
 }
@@ -2,6 +2,8 @@ package bitfab
 
 import (
 	"context"
+	"net/http"
+	"sync"
 	"testing"
 )
 
@@ -78,3 +80,73 @@ func TestWithSpanContext_GoroutineIsolation(t *testing.T) {
 		t.Errorf("goroutine with fresh context saw span %q, expected none", result)
 	}
 }
+
+// traceStateOf returns the state c holds for an open trace, or nil.
+func traceStateOf(c *Client, traceID string) *TraceState {
+	c.pendingMu.Lock()
+	defer c.pendingMu.Unlock()
+	for _, lt := range c.live {
+		if lt.traceID == traceID {
+			return lt.state
+		}
+	}
+	return nil
+}
+
+func TestTraceState_IsolatedPerClient(t *testing.T) {
+	t.Parallel()
+	tenantAExp := &recordingExporter{}
+	tenantA := NewClient("key-a", WithExporter(tenantAExp))
+	tenantBExp := &recordingExporter{}
+	tenantB := NewClient("key-b", WithExporter(tenantBExp))
+
+	// Both clients take part in the same trace, as with two tenants handling
+	// one propagated request in a single process.
+	ctxA, rootA := tenantA.Start(context.Background(), "gateway", "Handle")
+	GetCurrentTrace(ctxA).SetMetadata(map[string]any{"tenant": "a"})
+	GetCurrentTrace(ctxA).SetSessionID("session-a")
+
+	h := http.Header{}
+	InjectTraceContext(ctxA, h)
+	ctxB, rootB := tenantB.Start(ExtractTraceContext(context.Background(), h), "worker", "Work")
+	GetCurrentTrace(ctxB).SetMetadata(map[string]any{"tenant": "b"})
+	rootB.End()
+
+	if got := traceStateOf(tenantA, rootA.traceID).Metadata["tenant"]; got != "a" {
+		t.Errorf("tenant A metadata = %v, want a", got)
+	}
+	rootA.End()
+
+	if len(tenantAExp.traces) != 1 {
+		t.Fatalf("tenant A sent %d trace completions, want 1", len(tenantAExp.traces))
+	}
+	payload := tenantAExp.traces[0]
+	if payload["sessionId"] != "session-a" {
+		t.Errorf("sessionId = %v, want session-a", payload["sessionId"])
+	}
+	if md := payload["externalTrace"].(map[string]any)["metadata"].(map[string]any); md["tenant"] != "a" {
+		t.Errorf("metadata = %v, want tenant a only", md)
+	}
+}
+
+func TestTraceState_ConcurrentClients(t *testing.T) {
+	t.Parallel()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			exp := &recordingExporter{}
+			client := NewClient("test-key", WithExporter(exp))
+			client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+				GetCurrentTrace(ctx).SetMetadata(map[string]any{"client": i})
+				return nil, nil
+			})
+			md := exp.traces[0]["externalTrace"].(map[string]any)["metadata"].(map[string]any)
+			if md["client"] != i {
+				t.Errorf("client %d saw metadata %v", i, md)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
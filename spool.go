@@ -0,0 +1,396 @@
+package bitfab
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default spool parameters used when a SpoolOptions field is left at zero.
+const (
+	DefaultSpoolMaxBytes      = 64 << 20
+	DefaultSpoolSegmentBytes  = 4 << 20
+	DefaultSpoolRetryInterval = 30 * time.Second
+)
+
+const (
+	spoolSegmentPrefix = "segment-"
+	spoolSegmentSuffix = ".jsonl"
+)
+
+// SpoolOptions configures the on-disk spool. See WithSpool.
+type SpoolOptions struct {
+	// Dir is the directory holding spool segment files. It is created if it
+	// does not exist. Segments left behind by a previous process are replayed.
+	Dir string
+	// MaxBytes caps the total size of all segments. When the cap is exceeded
+	// the oldest segments are deleted.
+	MaxBytes int64
+	// SegmentBytes is the size at which the current segment is closed and a
+	// new one is started.
+	SegmentBytes int64
+	// RetryInterval is how often the background drainer tries to replay
+	// spooled payloads.
+	RetryInterval time.Duration
+}
+
+func (o SpoolOptions) withDefaults() SpoolOptions {
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = DefaultSpoolMaxBytes
+	}
+	if o.SegmentBytes <= 0 {
+		o.SegmentBytes = DefaultSpoolSegmentBytes
+	}
+	if o.SegmentBytes > o.MaxBytes {
+		o.SegmentBytes = o.MaxBytes
+	}
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = DefaultSpoolRetryInterval
+	}
+	return o
+}
+
+// spoolRecord is a single undelivered request stored in a segment file.
+type spoolRecord struct {
+	Endpoint string         `json:"endpoint"`
+	Payload  map[string]any `json:"payload"`
+}
+
+// spool is a directory of append-only segment files holding payloads that
+// could not be delivered. Records are appended to the newest segment and
+// replayed oldest-first by a background drainer.
+type spool struct {
+	h    *httpClient
+	opts SpoolOptions
+
+	mu          sync.Mutex
+	current     *os.File
+	currentName string
+	currentSize int64
+	sizes       map[string]int64 // segment name -> size, for all segments on disk
+	// spooledSpans counts the spans of each trace written by this process
+	// and not yet replayed, so the trace completion can be spooled after them.
+	spooledSpans map[string]int
+
+	drainMu sync.Mutex
+	stopCh  chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+func newSpool(h *httpClient, opts SpoolOptions) (*spool, error) {
+	opts = opts.withDefaults()
+	if opts.Dir == "" {
+		return nil, errors.New("bitfab: spool directory is empty")
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("bitfab: failed to create spool directory: %w", err)
+	}
+
+	s := &spool{
+		h:            h,
+		opts:         opts,
+		sizes:        make(map[string]int64),
+		spooledSpans: make(map[string]int),
+		stopCh:       make(chan struct{}),
+	}
+	names, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(opts.Dir, name))
+		if err != nil {
+			continue
+		}
+		s.sizes[name] = info.Size()
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// segments returns the names of all segment files, oldest first.
+func (s *spool) segments() ([]string, error) {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("bitfab: failed to read spool directory: %w", err)
+	}
+	var names []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && strings.HasPrefix(name, spoolSegmentPrefix) && strings.HasSuffix(name, spoolSegmentSuffix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// write appends a payload to the current segment, rotating and evicting old
+// segments as needed to stay within MaxBytes.
+func (s *spool) write(endpoint string, payload map[string]any) error {
+	line, err := json.Marshal(spoolRecord{Endpoint: endpoint, Payload: payload})
+	if err != nil {
+		return fmt.Errorf("bitfab: failed to marshal spool record: %w", err)
+	}
+	line = append(line, '\n')
+	n := int64(len(line))
+	if n > s.opts.MaxBytes {
+		return fmt.Errorf("bitfab: payload of %d bytes exceeds spool size cap", n)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil || s.currentSize+n > s.opts.SegmentBytes {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.current.Write(line); err != nil {
+		return fmt.Errorf("bitfab: failed to write spool segment: %w", err)
+	}
+	s.currentSize += n
+	s.sizes[s.currentName] = s.currentSize
+	if traceID := spooledSpanTraceID(endpoint, payload); traceID != "" {
+		s.spooledSpans[traceID]++
+	}
+	s.evictLocked()
+	return nil
+}
+
+// holdsSpansOf reports whether spans of the given trace are waiting in the
+// spool. Their trace completion must then be spooled too, so it is replayed
+// after them rather than reaching the API first.
+func (s *spool) holdsSpansOf(traceID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.spooledSpans[traceID] > 0
+}
+
+// replayed records that a spooled record is no longer waiting in the spool.
+func (s *spool) replayed(rec spoolRecord) {
+	traceID := spooledSpanTraceID(rec.Endpoint, rec.Payload)
+	if traceID == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.spooledSpans[traceID] <= 1 {
+		delete(s.spooledSpans, traceID)
+	} else {
+		s.spooledSpans[traceID]--
+	}
+}
+
+// spooledSpanTraceID returns the trace ID of a span payload, or "" for other
+// payloads.
+func spooledSpanTraceID(endpoint string, payload map[string]any) string {
+	if endpoint != "/api/sdk/externalSpans" {
+		return ""
+	}
+	traceID, _ := payload["sourceTraceId"].(string)
+	return traceID
+}
+
+// rotateLocked closes the current segment and opens a new one.
+func (s *spool) rotateLocked() error {
+	s.closeCurrentLocked()
+	name := fmt.Sprintf("%s%020d%s", spoolSegmentPrefix, time.Now().UnixNano(), spoolSegmentSuffix)
+	f, err := os.OpenFile(filepath.Join(s.opts.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("bitfab: failed to create spool segment: %w", err)
+	}
+	s.current = f
+	s.currentName = name
+	s.currentSize = 0
+	s.sizes[name] = 0
+	return nil
+}
+
+func (s *spool) closeCurrentLocked() {
+	if s.current != nil {
+		s.current.Close()
+		s.current = nil
+		s.currentName = ""
+		s.currentSize = 0
+	}
+}
+
+// evictLocked deletes the oldest segments until the spool fits in MaxBytes.
+// The current segment is never evicted.
+func (s *spool) evictLocked() {
+	var total int64
+	names := make([]string, 0, len(s.sizes))
+	for name, size := range s.sizes {
+		total += size
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if total <= s.opts.MaxBytes {
+			return
+		}
+		if name == s.currentName {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.opts.Dir, name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("bitfab: failed to evict spool segment: %v", err)
+			continue
+		}
+		log.Printf("bitfab: spool exceeds %d bytes, evicted segment %s", s.opts.MaxBytes, name)
+		total -= s.sizes[name]
+		delete(s.sizes, name)
+	}
+}
+
+func (s *spool) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.opts.RetryInterval)
+	defer ticker.Stop()
+
+	s.drain()
+	for {
+		select {
+		case <-ticker.C:
+			s.drain()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// drain replays spooled records oldest-first. It stops at the first record
+// that cannot be delivered, keeping it and everything after it for the next
+// attempt.
+func (s *spool) drain() {
+	s.drainMu.Lock()
+	defer s.drainMu.Unlock()
+
+	// Seal the current segment so it can be replayed and removed too.
+	s.mu.Lock()
+	s.closeCurrentLocked()
+	s.mu.Unlock()
+
+	names, err := s.segments()
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	for _, name := range names {
+		select {
+		case <-s.stopCh:
+			return
+		default:
+		}
+		if !s.drainSegment(name) {
+			return
+		}
+	}
+
+	// Spans in evicted segments are never replayed; once the spool is empty
+	// no trace has spans waiting in it.
+	s.mu.Lock()
+	if len(s.sizes) == 0 {
+		clear(s.spooledSpans)
+	}
+	s.mu.Unlock()
+}
+
+// drainSegment replays a single segment. It returns false if a record could
+// not be delivered, in which case the undelivered remainder is written back.
+func (s *spool) drainSegment(name string) bool {
+	s.mu.Lock()
+	active := name == s.currentName
+	s.mu.Unlock()
+	if active {
+		// Only sealed segments are replayed; the current one is still
+		// being appended to.
+		return true
+	}
+
+	path := filepath.Join(s.opts.Dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("bitfab: failed to read spool segment: %v", err)
+		}
+		return true
+	}
+
+	var remaining [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), int(s.opts.MaxBytes))
+	failed := false
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if failed {
+			remaining = append(remaining, append([]byte(nil), line...))
+			continue
+		}
+		var rec spoolRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			log.Printf("bitfab: discarding corrupt spool record: %v", err)
+			continue
+		}
+		if err := s.h.request(rec.Endpoint, rec.Payload, withTimeout(30*time.Second)); err != nil {
+			if isRetryable(err) {
+				failed = true
+				remaining = append(remaining, append([]byte(nil), line...))
+				continue
+			}
+			log.Printf("bitfab: discarding spooled payload rejected by API: %v", err)
+		}
+		s.replayed(rec)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sizes[name]; !ok {
+		// Evicted while it was being replayed.
+		return !failed
+	}
+	if len(remaining) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			log.Printf("bitfab: failed to remove spool segment: %v", err)
+		}
+		delete(s.sizes, name)
+		return !failed
+	}
+
+	var buf []byte
+	for _, line := range remaining {
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0o644); err == nil {
+		if err := os.Rename(tmp, path); err == nil {
+			s.sizes[name] = int64(len(buf))
+		}
+	}
+	return false
+}
+
+// close stops the drainer and closes the current segment. Undelivered
+// records stay on disk and are replayed by the next spool opened on Dir.
+func (s *spool) close() {
+	s.once.Do(func() {
+		close(s.stopCh)
+		s.wg.Wait()
+		s.mu.Lock()
+		s.closeCurrentLocked()
+		s.mu.Unlock()
+	})
+}
@@ -0,0 +1,246 @@
+package bitfab
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func spoolSegmentsIn(t *testing.T, dir string) []string {
+	t.Helper()
+	s := &spool{opts: SpoolOptions{Dir: dir}}
+	names, err := s.segments()
+	if err != nil {
+		t.Fatalf("segments: %v", err)
+	}
+	return names
+}
+
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestSpool_ReplaysWhenAPIBecomesReachable(t *testing.T) {
+	var reachable atomic.Bool
+	var mu sync.Mutex
+	var paths []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !reachable.Load() {
+			w.WriteHeader(503)
+			return
+		}
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithSpool(SpoolOptions{Dir: dir, RetryInterval: 20 * time.Millisecond}))
+	defer client.Shutdown(context.Background())
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		return "done", nil
+	})
+	client.FlushTraces(5 * time.Second)
+
+	if len(spoolSegmentsIn(t, dir)) == 0 {
+		t.Fatal("expected undelivered payloads to be spooled to disk")
+	}
+
+	reachable.Store(true)
+	if !waitFor(t, 5*time.Second, func() bool { return len(spoolSegmentsIn(t, dir)) == 0 }) {
+		t.Fatal("spool was not drained after the API became reachable")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	var spans, traces int
+	for _, p := range paths {
+		if strings.HasSuffix(p, "externalSpans") {
+			spans++
+		}
+		if strings.HasSuffix(p, "externalTraces") {
+			traces++
+		}
+	}
+	if spans != 1 || traces != 1 {
+		t.Errorf("replayed %d spans and %d traces, want 1 and 1", spans, traces)
+	}
+}
+
+func TestSpool_TraceCompletionFollowsSpooledSpans(t *testing.T) {
+	var spansReachable atomic.Bool
+	var mu sync.Mutex
+	var paths []string
+
+	// Only span requests fail, so a trace completion sent live would be
+	// accepted before its spans.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "externalSpans") && !spansReachable.Load() {
+			w.WriteHeader(503)
+			return
+		}
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	client := NewClient("test-key", WithServiceURL(server.URL),
+		WithSpool(SpoolOptions{Dir: dir, RetryInterval: 20 * time.Millisecond}))
+	defer client.Shutdown(context.Background())
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		return "done", nil
+	})
+	client.FlushTraces(5 * time.Second)
+
+	mu.Lock()
+	sentLive := len(paths)
+	mu.Unlock()
+	if sentLive != 0 {
+		t.Fatalf("trace completion was sent before its spooled span: %v", paths)
+	}
+
+	spansReachable.Store(true)
+	if !waitFor(t, 5*time.Second, func() bool { return len(spoolSegmentsIn(t, dir)) == 0 }) {
+		t.Fatal("spool was not drained after the API became reachable")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != 2 || !strings.HasSuffix(paths[0], "externalSpans") || !strings.HasSuffix(paths[1], "externalTraces") {
+		t.Errorf("replayed %v, want the span before the trace completion", paths)
+	}
+}
+
+func TestSpool_ReplaysSegmentsFromPreviousProcess(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		if payload["traceFunctionKey"] == "leftover" {
+			received.Add(1)
+		}
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"success": true})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	line, _ := json.Marshal(spoolRecord{
+		Endpoint: "/api/sdk/externalSpans",
+		Payload:  map[string]any{"traceFunctionKey": "leftover"},
+	})
+	seg := filepath.Join(dir, spoolSegmentPrefix+"00000000000000000001"+spoolSegmentSuffix)
+	if err := os.WriteFile(seg, append(line, '\n'), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := newHTTPClient("test-key", server.URL)
+	sp, err := newSpool(h, SpoolOptions{Dir: dir, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	if !waitFor(t, 5*time.Second, func() bool { return received.Load() == 1 }) {
+		t.Fatal("leftover segment was not replayed on startup")
+	}
+	if !waitFor(t, time.Second, func() bool { return len(spoolSegmentsIn(t, dir)) == 0 }) {
+		t.Error("replayed segment was not removed")
+	}
+}
+
+func TestSpool_EvictsOldestSegments(t *testing.T) {
+	dir := t.TempDir()
+	h := newHTTPClient("test-key", "http://127.0.0.1:1")
+	sp, err := newSpool(h, SpoolOptions{Dir: dir, MaxBytes: 1000, SegmentBytes: 200, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+
+	for i := 0; i < 50; i++ {
+		if err := sp.write("/api/sdk/externalSpans", map[string]any{"i": i, "pad": strings.Repeat("x", 50)}); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	var total int64
+	names := spoolSegmentsIn(t, dir)
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += info.Size()
+	}
+	if total > 1000 {
+		t.Errorf("spool size = %d bytes, want <= 1000", total)
+	}
+
+	// The newest record must have survived eviction.
+	data, err := os.ReadFile(filepath.Join(dir, names[len(names)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"i":49`) {
+		t.Error("newest record was evicted")
+	}
+}
+
+func TestSpool_DiscardsPayloadsRejectedByAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(map[string]any{"error": "Unknown function"})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	h := newHTTPClient("test-key", server.URL)
+	sp, err := newSpool(h, SpoolOptions{Dir: dir, RetryInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("newSpool: %v", err)
+	}
+	defer sp.close()
+	h.spool = sp
+
+	h.sendExternalSpan(map[string]any{"test": true})
+	h.flush(5 * time.Second)
+
+	if names := spoolSegmentsIn(t, dir); len(names) != 0 {
+		t.Errorf("payload rejected by the API should not be spooled, found %v", names)
+	}
+}
+
+func TestSpool_EmptyDirDisablesSpool(t *testing.T) {
+	client := NewClient("test-key", WithSpool(SpoolOptions{}))
+	if client.exporter.(*httpClient).spool != nil {
+		t.Error("spool should be disabled when Dir is empty")
+	}
+}
@@ -0,0 +1,79 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+)
+
+// StatusCode is the outcome of a span, recorded in span_data.status.
+type StatusCode string
+
+// Span status codes.
+const (
+	// StatusOK means the operation completed successfully.
+	StatusOK StatusCode = "ok"
+	// StatusError means the operation failed.
+	StatusError StatusCode = "error"
+	// StatusCancelled means the operation was cancelled by its caller.
+	StatusCancelled StatusCode = "cancelled"
+	// StatusTimeout means the operation ran out of time.
+	StatusTimeout StatusCode = "timeout"
+	// StatusBlocked means the operation was intentionally stopped, e.g. by a
+	// guardrail. It is not a failure of the operation itself.
+	StatusBlocked StatusCode = "blocked"
+)
+
+// SetStatus sets the span status and an optional human-readable description,
+// overriding the status derived from the span's error:
+//
+//	if flagged {
+//	    span.SetStatus(bitfab.StatusBlocked, "prompt injection detected")
+//	}
+//
+// Without an explicit status, a span is StatusOK if it has no error,
+// StatusCancelled or StatusTimeout if its error wraps context.Canceled or
+// context.DeadlineExceeded, and StatusError otherwise.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) SetStatus(code StatusCode, description string) {
+	defer func() { recover() }()
+	if s == nil || code == "" {
+		return
+	}
+	s.status = code
+	s.statusDescription = description
+}
+
+// spanStatus returns the span_data.status value for a span with the given
+// explicit status and error.
+func spanStatus(code StatusCode, description string, err error) map[string]any {
+	if code == "" {
+		code = statusFromError(err)
+		if err != nil {
+			description = err.Error()
+		}
+	}
+	status := map[string]any{"code": string(code)}
+	if description != "" {
+		status["description"] = description
+	}
+	return status
+}
+
+// statusFromError derives a status code from an error.
+func statusFromError(err error) StatusCode {
+	switch {
+	case err == nil:
+		return StatusOK
+	case errors.Is(err, context.Canceled):
+		return StatusCancelled
+	case errors.Is(err, context.DeadlineExceeded):
+		return StatusTimeout
+	default:
+		return StatusError
+	}
+}
+
+// isFailure reports whether code marks a span as failed.
+func isFailure(code StatusCode) bool {
+	return code == StatusError || code == StatusCancelled || code == StatusTimeout
+}
@@ -0,0 +1,107 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func spanStatusOf(t *testing.T, exp *recordingExporter, i int) map[string]any {
+	t.Helper()
+	status, ok := exp.spanData(i)["status"].(map[string]any)
+	if !ok {
+		t.Fatalf("span %d has no status: %v", i, exp.spanData(i))
+	}
+	return status
+}
+
+func TestStatus_DerivedFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want StatusCode
+	}{
+		{"success", nil, StatusOK},
+		{"failure", errors.New("boom"), StatusError},
+		{"cancelled", fmt.Errorf("fetch: %w", context.Canceled), StatusCancelled},
+		{"timeout", context.DeadlineExceeded, StatusTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := &recordingExporter{}
+			client := NewClient("test-key", WithExporter(exp))
+
+			client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+				return nil, tt.err
+			})
+
+			status := spanStatusOf(t, exp, 0)
+			if status["code"] != string(tt.want) {
+				t.Errorf("code = %v, want %s", status["code"], tt.want)
+			}
+			if tt.err != nil && status["description"] != tt.err.Error() {
+				t.Errorf("description = %v, want %q", status["description"], tt.err.Error())
+			}
+			if tt.err == nil {
+				if _, ok := status["description"]; ok {
+					t.Errorf("description = %v, want omitted", status["description"])
+				}
+			}
+		})
+	}
+}
+
+func TestStatus_ContextDeadlineInSpan(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	client.Span(ctx, "test", func(ctx context.Context) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	if code := spanStatusOf(t, exp, 0)["code"]; code != "timeout" {
+		t.Errorf("code = %v, want timeout", code)
+	}
+}
+
+func TestStatus_BlockedWithoutError(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "guard", "PIICheck", WithType("guardrail"))
+	span.SetStatus(StatusBlocked, "email address in prompt")
+	span.End()
+
+	status := spanStatusOf(t, exp, 0)
+	if status["code"] != "blocked" || status["description"] != "email address in prompt" {
+		t.Errorf("status = %v", status)
+	}
+	if _, ok := exp.spanData(0)["error"]; ok {
+		t.Error("a blocked span should not record an error")
+	}
+}
+
+func TestStatus_ExplicitOverridesError(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "test", "Work")
+	span.SetError(errors.New("upstream rejected"))
+	span.SetStatus(StatusBlocked, "")
+	span.End()
+
+	if status := spanStatusOf(t, exp, 0); status["code"] != "blocked" {
+		t.Errorf("status = %v, want blocked", status)
+	}
+	if exp.spanData(0)["error"] != "upstream rejected" {
+		t.Error("the error should still be recorded")
+	}
+
+	var nilSpan *ActiveSpan
+	nilSpan.SetStatus(StatusOK, "")
+}
@@ -0,0 +1,72 @@
+package bitfab
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamState accumulates the chunks of a streamed response. Chunks may be
+// recorded from a different goroutine than the one that ends the span.
+type streamState struct {
+	mu         sync.Mutex
+	chunks     int
+	firstChunk time.Time
+	lastChunk  time.Time
+	text       strings.Builder
+}
+
+// RecordChunk records one chunk of a streamed response, such as an LLM token
+// delta. The first chunk marks the time to first token, and the chunk texts
+// are concatenated into the span output when End is called, unless an output
+// was set explicitly. Pass an empty string to record only the chunk's timing.
+//
+// At End the span records span_data.stream with the chunk count and the
+// times of the first and last chunk, plus time_to_first_token_ms and
+// tokens_per_second. Throughput uses the completion tokens from
+// SetTokenUsage when set, and the chunk count otherwise.
+// Safe to call on nil receiver (no-op).
+func (s *ActiveSpan) RecordChunk(text string) {
+	defer func() { recover() }()
+	if s == nil || s.client == nil {
+		return
+	}
+	now := time.Now()
+
+	s.stream.mu.Lock()
+	defer s.stream.mu.Unlock()
+	if s.stream.chunks == 0 {
+		s.stream.firstChunk = now
+	}
+	s.stream.lastChunk = now
+	s.stream.chunks++
+	s.stream.text.WriteString(text)
+}
+
+// apply writes the streaming metrics into spanData for a span that started at
+// start and ended at end. It returns the aggregated chunk text, or "" if no
+// chunks were recorded.
+func (st *streamState) apply(spanData map[string]any, start, end time.Time, usage *TokenUsage) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.chunks == 0 {
+		return ""
+	}
+
+	spanData["stream"] = map[string]any{
+		"chunk_count":    st.chunks,
+		"first_chunk_at": st.firstChunk.UTC().Format("2006-01-02T15:04:05.000Z"),
+		"last_chunk_at":  st.lastChunk.UTC().Format("2006-01-02T15:04:05.000Z"),
+	}
+	spanData["time_to_first_token_ms"] = st.firstChunk.Sub(start).Milliseconds()
+
+	tokens := st.chunks
+	if usage != nil && usage.CompletionTokens > 0 {
+		tokens = usage.CompletionTokens
+	}
+	// Throughput is measured over the generation phase, after the first token.
+	if generation := end.Sub(st.firstChunk); generation > 0 {
+		spanData["tokens_per_second"] = float64(tokens) / generation.Seconds()
+	}
+	return st.text.String()
+}
@@ -0,0 +1,121 @@
+package bitfab
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordChunk_AssemblesOutputAndMetrics(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Stream", WithType("llm"))
+	time.Sleep(20 * time.Millisecond)
+	for _, chunk := range []string{"Hel", "lo", ", world"} {
+		span.RecordChunk(chunk)
+		time.Sleep(5 * time.Millisecond)
+	}
+	span.End()
+
+	spanData := exp.spanData(0)
+	if spanData["output"] != "Hello, world" {
+		t.Errorf("output = %v, want the concatenated chunks", spanData["output"])
+	}
+	if ttft := spanData["time_to_first_token_ms"].(int64); ttft < 20 {
+		t.Errorf("time_to_first_token_ms = %d, want >= 20", ttft)
+	}
+	if tps, ok := spanData["tokens_per_second"].(float64); !ok || tps <= 0 {
+		t.Errorf("tokens_per_second = %v", spanData["tokens_per_second"])
+	}
+	stream := spanData["stream"].(map[string]any)
+	if stream["chunk_count"] != 3 {
+		t.Errorf("chunk_count = %v, want 3", stream["chunk_count"])
+	}
+	if stream["first_chunk_at"].(string) > stream["last_chunk_at"].(string) {
+		t.Errorf("first chunk %v after last chunk %v", stream["first_chunk_at"], stream["last_chunk_at"])
+	}
+}
+
+func TestRecordChunk_ExplicitOutputWins(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Stream")
+	span.RecordChunk("partial")
+	span.SetOutput(map[string]any{"text": "final"})
+	span.End()
+
+	if out, ok := exp.spanData(0)["output"].(map[string]any); !ok || out["text"] != "final" {
+		t.Errorf("output = %v, want the explicit output", exp.spanData(0)["output"])
+	}
+}
+
+func TestRecordChunk_TokensPerSecondUsesCompletionTokens(t *testing.T) {
+	st := &streamState{chunks: 2}
+	start := time.Now()
+	st.firstChunk = start.Add(100 * time.Millisecond)
+	st.lastChunk = start.Add(500 * time.Millisecond)
+	spanData := map[string]any{}
+
+	st.apply(spanData, start, start.Add(2100*time.Millisecond), &TokenUsage{CompletionTokens: 50})
+
+	if spanData["time_to_first_token_ms"] != int64(100) {
+		t.Errorf("time_to_first_token_ms = %v, want 100", spanData["time_to_first_token_ms"])
+	}
+	if spanData["tokens_per_second"] != 25.0 {
+		t.Errorf("tokens_per_second = %v, want 50 tokens over 2s", spanData["tokens_per_second"])
+	}
+}
+
+func TestRecordChunk_TimingOnlyChunks(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Stream")
+	span.RecordChunk("")
+	span.RecordChunk("")
+	span.End()
+
+	spanData := exp.spanData(0)
+	if _, ok := spanData["output"]; ok {
+		t.Errorf("output = %v, want omitted for timing-only chunks", spanData["output"])
+	}
+	if _, ok := spanData["time_to_first_token_ms"]; !ok {
+		t.Error("time_to_first_token_ms should be recorded")
+	}
+}
+
+func TestRecordChunk_NoChunksNoMetrics(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	_, span := client.Start(context.Background(), "chat", "Plain")
+	span.End()
+
+	for _, key := range []string{"stream", "time_to_first_token_ms", "tokens_per_second"} {
+		if _, ok := exp.spanData(0)[key]; ok {
+			t.Errorf("%s should be omitted without chunks", key)
+		}
+	}
+}
+
+func TestRecordChunk_ConcurrentWithEnd(t *testing.T) {
+	client := NewClient("test-key", WithExporter(&recordingExporter{}))
+	_, span := client.Start(context.Background(), "chat", "Stream")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			span.RecordChunk("x")
+		}
+	}()
+	span.End()
+	wg.Wait()
+
+	var nilSpan *ActiveSpan
+	nilSpan.RecordChunk("ignored")
+}
@@ -0,0 +1,163 @@
+package bitfab
+
+import (
+	"log"
+	"reflect"
+	"time"
+)
+
+// Default tail sampling buffer limits used when a TailSamplingOptions field
+// is left at zero. The same limits bound traces buffered by SampleErrors.
+const (
+	DefaultMaxSpansPerTrace = 1000
+	DefaultMaxBufferedSpans = 10000
+)
+
+// TailSamplingOptions configures tail-based sampling. See WithTailSampling.
+type TailSamplingOptions struct {
+	// Policies decide whether a completed trace is exported. A trace is
+	// exported if any policy keeps it; with no policies, nothing is exported.
+	Policies []TailPolicy
+	// MaxSpansPerTrace bounds the spans buffered for a single trace. Spans
+	// beyond the limit are dropped; the rest of the trace is still exported
+	// if it is kept.
+	MaxSpansPerTrace int
+	// MaxBufferedSpans bounds the spans buffered across all open traces.
+	// Spans ending while the buffer is full are dropped.
+	MaxBufferedSpans int
+}
+
+func (o TailSamplingOptions) withDefaults() TailSamplingOptions {
+	if o.MaxSpansPerTrace <= 0 {
+		o.MaxSpansPerTrace = DefaultMaxSpansPerTrace
+	}
+	if o.MaxBufferedSpans <= 0 {
+		o.MaxBufferedSpans = DefaultMaxBufferedSpans
+	}
+	return o
+}
+
+// CompletedTrace summarizes a buffered trace when its local root span ends,
+// for evaluation by tail sampling policies.
+type CompletedTrace struct {
+	TraceID          string
+	TraceFunctionKey string
+	RootName         string
+	// Duration is the duration of the local root span.
+	Duration time.Duration
+	// Failed is set if any span of the trace failed.
+	Failed bool
+	// SpanCount is the number of spans buffered for the trace.
+	SpanCount int
+	// Metadata is the trace metadata set through CurrentTrace.SetMetadata.
+	Metadata map[string]any
+}
+
+// TailPolicy decides whether a completed trace is exported.
+type TailPolicy interface {
+	Keep(t CompletedTrace) bool
+}
+
+// TailPolicyFunc adapts a function to the TailPolicy interface.
+type TailPolicyFunc func(t CompletedTrace) bool
+
+// Keep implements TailPolicy.
+func (f TailPolicyFunc) Keep(t CompletedTrace) bool {
+	return f(t)
+}
+
+// KeepErrors keeps traces in which any span failed.
+func KeepErrors() TailPolicy {
+	return TailPolicyFunc(func(t CompletedTrace) bool { return t.Failed })
+}
+
+// KeepSlowerThan keeps traces whose root span took at least d.
+func KeepSlowerThan(d time.Duration) TailPolicy {
+	return TailPolicyFunc(func(t CompletedTrace) bool { return t.Duration >= d })
+}
+
+// KeepMetadata keeps traces whose metadata has key set to value.
+func KeepMetadata(key string, value any) TailPolicy {
+	return TailPolicyFunc(func(t CompletedTrace) bool {
+		v, ok := t.Metadata[key]
+		return ok && reflect.DeepEqual(v, value)
+	})
+}
+
+// KeepRatio keeps the given fraction of traces, from 0 (none) to 1 (all).
+// Use it last as a fallback to retain a baseline of ordinary traces.
+func KeepRatio(ratio float64) TailPolicy {
+	return TailPolicyFunc(func(t CompletedTrace) bool { return sampledByRatio(t.TraceID, ratio) })
+}
+
+// WithTailSampling buffers the spans of every trace in memory until its local
+// root span ends, and then exports or drops the whole trace according to the
+// policies:
+//
+//	bitfab.WithTailSampling(bitfab.TailSamplingOptions{
+//	    Policies: []bitfab.TailPolicy{
+//	        bitfab.KeepErrors(),
+//	        bitfab.KeepSlowerThan(2 * time.Second),
+//	        bitfab.KeepRatio(0.05),
+//	    },
+//	})
+//
+// Tail sampling applies to traces sampled by the head Sampler, if one is set;
+// traces it drops are never buffered. The decision is local to this service:
+// downstream services receiving the trace context record their part of a
+// sampled trace regardless of the outcome here.
+func WithTailSampling(opts TailSamplingOptions) Option {
+	return func(c *Client) {
+		opts = opts.withDefaults()
+		c.tail = &opts
+	}
+}
+
+// keep evaluates the policies for a completed trace. A panicking policy
+// keeps the trace.
+func (o *TailSamplingOptions) keep(t CompletedTrace) (kept bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			kept = true
+			func() {
+				defer func() { recover() }()
+				log.Printf("bitfab: panic in tail sampling policy: %v", r)
+			}()
+		}
+	}()
+	for _, p := range o.Policies {
+		if p.Keep(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// buffers reports whether spans of a trace with the given head sampling
+// decision are buffered until the local root ends.
+func (c *Client) buffers(sampling SamplingDecision) bool {
+	return sampling == DecisionSampleOnError || (sampling == DecisionSample && c.tail != nil)
+}
+
+// keepDeferred decides whether a buffered trace is exported when its local
+// root span s ends.
+func (c *Client) keepDeferred(s *ActiveSpan, d *deferredTrace, ts *TraceState) bool {
+	if s.sampling == DecisionSampleOnError {
+		return d.failed
+	}
+	t := CompletedTrace{
+		TraceID:          s.traceID,
+		TraceFunctionKey: s.traceFunctionKey,
+		RootName:         s.cfg.name,
+		Duration:         time.Since(s.start),
+		Failed:           d.failed,
+		SpanCount:        len(d.payloads),
+	}
+	ts.mu.Lock()
+	t.Metadata = make(map[string]any, len(ts.Metadata))
+	for k, v := range ts.Metadata {
+		t.Metadata[k] = v
+	}
+	ts.mu.Unlock()
+	return c.tail.keep(t)
+}
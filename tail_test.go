@@ -0,0 +1,147 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTailSampling_KeepsFailedTraces(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithTailSampling(TailSamplingOptions{
+		Policies: []TailPolicy{KeepErrors()},
+	}))
+
+	runNestedTrace(client, "test", nil)
+	if len(exp.spans) != 0 || len(exp.traces) != 0 {
+		t.Fatalf("successful trace exported %d spans and %d traces, want none", len(exp.spans), len(exp.traces))
+	}
+
+	runNestedTrace(client, "test", errors.New("child failed"))
+	if len(exp.spans) != 2 || len(exp.traces) != 1 {
+		t.Errorf("failed trace exported %d spans and %d traces, want 2 and 1", len(exp.spans), len(exp.traces))
+	}
+
+	client.pendingMu.Lock()
+	defer client.pendingMu.Unlock()
+	if len(client.deferred) != 0 || client.buffered != 0 {
+		t.Errorf("deferred = %d, buffered = %d, want empty buffer", len(client.deferred), client.buffered)
+	}
+}
+
+func TestTailSampling_KeepsSlowTraces(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithTailSampling(TailSamplingOptions{
+		Policies: []TailPolicy{KeepSlowerThan(20 * time.Millisecond)},
+	}))
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) { return nil, nil })
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		time.Sleep(30 * time.Millisecond)
+		return nil, nil
+	}, WithName("Slow"))
+
+	if len(exp.spans) != 1 || exp.spanData(0)["name"] != "Slow" {
+		t.Errorf("exported %d spans, want only the slow one", len(exp.spans))
+	}
+}
+
+func TestTailSampling_KeepsMatchingMetadata(t *testing.T) {
+	exp := &recordingExporter{}
+	var seen CompletedTrace
+	client := NewClient("test-key", WithExporter(exp), WithTailSampling(TailSamplingOptions{
+		Policies: []TailPolicy{
+			TailPolicyFunc(func(t CompletedTrace) bool { seen = t; return false }),
+			KeepMetadata("tier", "enterprise"),
+		},
+	}))
+
+	for _, tier := range []string{"free", "enterprise"} {
+		client.Span(context.Background(), "chat", func(ctx context.Context) (any, error) {
+			GetCurrentTrace(ctx).SetMetadata(map[string]any{"tier": tier})
+			return nil, nil
+		}, WithName("Chat"))
+	}
+
+	if len(exp.spans) != 1 || len(exp.traces) != 1 {
+		t.Fatalf("exported %d spans and %d traces, want the enterprise trace only", len(exp.spans), len(exp.traces))
+	}
+	if seen.TraceFunctionKey != "chat" || seen.RootName != "Chat" || seen.SpanCount != 1 || seen.Failed {
+		t.Errorf("completed trace = %+v", seen)
+	}
+}
+
+func TestTailSampling_NoPoliciesDropsEverything(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithTailSampling(TailSamplingOptions{}))
+
+	runNestedTrace(client, "test", errors.New("failed"))
+	if len(exp.spans) != 0 {
+		t.Errorf("exported %d spans, want none", len(exp.spans))
+	}
+}
+
+func TestTailSampling_RespectsHeadDecision(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithSampler(RatioSampler(0)),
+		WithTailSampling(TailSamplingOptions{Policies: []TailPolicy{KeepRatio(1)}}))
+
+	runNestedTrace(client, "test", nil)
+	if len(exp.spans) != 0 {
+		t.Errorf("exported %d spans of a head-dropped trace, want none", len(exp.spans))
+	}
+}
+
+func TestTailSampling_MaxSpansPerTrace(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithTailSampling(TailSamplingOptions{
+		Policies:         []TailPolicy{KeepRatio(1)},
+		MaxSpansPerTrace: 3,
+	}))
+
+	client.Span(context.Background(), "test", func(ctx context.Context) (any, error) {
+		for i := 0; i < 5; i++ {
+			client.Span(ctx, "test", func(ctx context.Context) (any, error) { return nil, nil })
+		}
+		return nil, nil
+	})
+
+	if len(exp.spans) != 3 {
+		t.Errorf("exported %d spans, want the per-trace cap of 3", len(exp.spans))
+	}
+}
+
+func TestTailSampling_MaxBufferedSpans(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithTailSampling(TailSamplingOptions{
+		Policies:         []TailPolicy{KeepRatio(1)},
+		MaxBufferedSpans: 2,
+	}))
+
+	// Two traces open at once share the global buffer.
+	ctxA, rootA := client.Start(context.Background(), "test", "A")
+	ctxB, rootB := client.Start(context.Background(), "test", "B")
+	_, childA := client.Start(ctxA, "test", "A1")
+	childA.End()
+	_, childB := client.Start(ctxB, "test", "B1")
+	childB.End()
+	rootA.End()
+	rootB.End()
+
+	if len(exp.spans) != 3 {
+		t.Errorf("exported %d spans, want 3: both children, then B's root once A's buffer was released", len(exp.spans))
+	}
+}
+
+func TestTailSampling_PanickingPolicyKeepsTrace(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp), WithTailSampling(TailSamplingOptions{
+		Policies: []TailPolicy{TailPolicyFunc(func(CompletedTrace) bool { panic("bad policy") })},
+	}))
+
+	runNestedTrace(client, "test", nil)
+	if len(exp.spans) != 2 {
+		t.Errorf("exported %d spans, want 2", len(exp.spans))
+	}
+}
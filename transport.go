@@ -0,0 +1,167 @@
+package bitfab
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// TransportOption configures the spans created by Client.Transport.
+type TransportOption func(*transportConfig)
+
+type transportConfig struct {
+	spanName     func(r *http.Request) string
+	spanType     string
+	maxBodyBytes int
+}
+
+// WithTransportSpanName sets how the span name is derived from the outgoing
+// request. Defaults to the method, host and path, e.g. "POST api.openai.com/v1/chat/completions".
+func WithTransportSpanName(fn func(r *http.Request) string) TransportOption {
+	return func(c *transportConfig) { c.spanName = fn }
+}
+
+// WithTransportSpanType sets the span type. Defaults to "custom".
+func WithTransportSpanType(spanType string) TransportOption {
+	return func(c *transportConfig) { c.spanType = spanType }
+}
+
+// WithTransportBodyCapture records request and response bodies as span input
+// and output, each truncated to maxBytes. Bodies are not captured by default.
+func WithTransportBodyCapture(maxBytes int) TransportOption {
+	return func(c *transportConfig) { c.maxBodyBytes = maxBytes }
+}
+
+// Transport returns an http.RoundTripper that traces outgoing requests made
+// with base (http.DefaultTransport if nil). Each request whose context carries
+// a span gets a child span under traceFunctionKey recording the method, URL,
+// status code and timing, and W3C trace context headers are injected so
+// instrumented services continue the trace. Requests made outside a span are
+// passed through untraced.
+//
+// The span ends when the response body is read to EOF or closed, so its
+// duration covers streamed responses. For a 101 Switching Protocols response
+// the span ends with the handshake and the upgraded connection is returned
+// as is. Transport errors and responses with a 4xx or 5xx status are recorded
+// as errors.
+func (c *Client) Transport(traceFunctionKey string, base http.RoundTripper, opts ...TransportOption) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	cfg := transportConfig{
+		spanName: func(r *http.Request) string { return r.Method + " " + r.URL.Host + r.URL.Path },
+		spanType: "custom",
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &tracingTransport{client: c, traceFunctionKey: traceFunctionKey, base: base, cfg: cfg}
+}
+
+type tracingTransport struct {
+	client           *Client
+	traceFunctionKey string
+	base             http.RoundTripper
+	cfg              transportConfig
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if currentSpan(req.Context()) == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, span := t.client.Start(req.Context(), t.traceFunctionKey, t.cfg.spanName(req), WithType(t.cfg.spanType))
+
+	// A RoundTripper must not modify the caller's request.
+	req = req.Clone(ctx)
+	InjectTraceContext(ctx, req.Header)
+
+	var reqBody *limitedBuffer
+	if t.cfg.maxBodyBytes > 0 && req.Body != nil && req.Body != http.NoBody {
+		reqBody = &limitedBuffer{max: t.cfg.maxBodyBytes}
+		req.Body = &teeReadCloser{ReadCloser: req.Body, w: reqBody}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+
+	input := map[string]any{
+		"method": req.Method,
+		"url":    req.URL.String(),
+	}
+	if reqBody != nil {
+		input["body"] = reqBody.String()
+	}
+	span.SetInput(input)
+
+	if err != nil {
+		span.SetError(err)
+		span.End()
+		return resp, err
+	}
+
+	output := map[string]any{"status_code": resp.StatusCode}
+	span.SetOutput(output)
+	span.AddContext(map[string]any{
+		"http.method":      req.Method,
+		"http.url":         req.URL.String(),
+		"http.status_code": resp.StatusCode,
+	})
+	if resp.StatusCode >= 400 {
+		span.SetError(fmt.Errorf("HTTP %d %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
+	}
+
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		// The body is the upgraded connection, an io.ReadWriteCloser that may
+		// stay open indefinitely. Leave it unwrapped so callers can write to
+		// it, and let the span cover the handshake only.
+		span.End()
+		return resp, nil
+	}
+
+	body := &spanEndingBody{ReadCloser: resp.Body, span: span, output: output}
+	if t.cfg.maxBodyBytes > 0 {
+		body.captured = &limitedBuffer{max: t.cfg.maxBodyBytes}
+	}
+	resp.Body = body
+	return resp, nil
+}
+
+// spanEndingBody ends the span of an outgoing request once its response
+// body has been read to EOF or closed.
+type spanEndingBody struct {
+	io.ReadCloser
+	span     *ActiveSpan
+	output   map[string]any
+	captured *limitedBuffer
+	once     sync.Once
+}
+
+func (b *spanEndingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && b.captured != nil {
+		b.captured.Write(p[:n])
+	}
+	if err != nil {
+		if err != io.EOF {
+			b.span.SetError(err)
+		}
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanEndingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.end()
+	return err
+}
+
+func (b *spanEndingBody) end() {
+	b.once.Do(func() {
+		if b.captured != nil {
+			b.output["body"] = b.captured.String()
+		}
+		b.span.End()
+	})
+}
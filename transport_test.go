@@ -0,0 +1,193 @@
+package bitfab
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTransport_TracesOutgoingRequest(t *testing.T) {
+	var gotTraceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get(TraceparentHeader)
+		io.ReadAll(r.Body)
+		w.Write([]byte(`{"choices":[{"text":"hi there"}]}`))
+	}))
+	defer server.Close()
+
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	httpClient := &http.Client{Transport: client.Transport("llm-calls", nil,
+		WithTransportSpanType("llm"), WithTransportBodyCapture(12))}
+
+	ctx, root := client.Start(context.Background(), "agent", "Run")
+	req, _ := http.NewRequestWithContext(ctx, "POST", server.URL+"/v1/complete", strings.NewReader(`{"prompt":"hello"}`))
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+	root.End()
+
+	if req.Header.Get(TraceparentHeader) != "" {
+		t.Error("transport must not modify the caller's request headers")
+	}
+	if len(exp.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exp.spans))
+	}
+	raw := rawSpanOf(exp.spans[0])
+	if raw["parent_id"] != root.spanID {
+		t.Errorf("outgoing span parent_id = %v, want %v", raw["parent_id"], root.spanID)
+	}
+	if !strings.Contains(gotTraceparent, otlpID(raw["id"].(string), 8)) {
+		t.Errorf("traceparent %q should reference the outgoing span", gotTraceparent)
+	}
+
+	spanData := exp.spanData(0)
+	if spanData["type"] != "llm" {
+		t.Errorf("type = %v, want llm", spanData["type"])
+	}
+	if !strings.HasPrefix(spanData["name"].(string), "POST 127.0.0.1") {
+		t.Errorf("name = %v", spanData["name"])
+	}
+	input := spanData["input"].(map[string]any)
+	if input["body"] != `{"prompt":"h...[truncated 6 bytes]` {
+		t.Errorf("request body = %q", input["body"])
+	}
+	output := spanData["output"].(map[string]any)
+	if output["status_code"] != 200 {
+		t.Errorf("status_code = %v, want 200", output["status_code"])
+	}
+	if output["body"] != `{"choices":[...[truncated 21 bytes]` {
+		t.Errorf("response body = %q", output["body"])
+	}
+}
+
+func TestTransport_RecordsErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	httpClient := &http.Client{Transport: client.Transport("calls", nil)}
+
+	ctx, root := client.Start(context.Background(), "agent", "Run")
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	root.End()
+
+	if got := exp.spanData(0)["error"]; got != "HTTP 429 Too Many Requests" {
+		t.Errorf("error = %v", got)
+	}
+}
+
+func TestTransport_RecordsTransportError(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	httpClient := &http.Client{Transport: client.Transport("calls", nil)}
+
+	ctx, root := client.Start(context.Background(), "agent", "Run")
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://127.0.0.1:1", nil)
+	if _, err := httpClient.Do(req); err == nil {
+		t.Fatal("expected connection error")
+	}
+	root.End()
+
+	if len(exp.spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(exp.spans))
+	}
+	if _, ok := exp.spanData(0)["error"]; !ok {
+		t.Error("transport error should be recorded on the span")
+	}
+}
+
+func TestTransport_PassesThroughOutsideSpan(t *testing.T) {
+	var gotTraceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTraceparent = r.Header.Get(TraceparentHeader)
+	}))
+	defer server.Close()
+
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	httpClient := &http.Client{Transport: client.Transport("calls", nil)}
+
+	resp, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(exp.spans) != 0 {
+		t.Errorf("exported %d spans for a request outside a span, want 0", len(exp.spans))
+	}
+	if gotTraceparent != "" {
+		t.Error("traceparent should not be injected outside a span")
+	}
+}
+
+func TestTransport_SwitchingProtocolsKeepsWriter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("hijack failed: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(rw, buf); err == nil {
+			conn.Write(buf)
+		}
+	}))
+	defer server.Close()
+
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	httpClient := &http.Client{Transport: client.Transport("upgrades", nil)}
+
+	ctx, root := client.Start(context.Background(), "agent", "Run")
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/echo", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The span covers the handshake and ends before the connection is used.
+	exp.mu.Lock()
+	spans := len(exp.spans)
+	exp.mu.Unlock()
+	if spans != 1 {
+		t.Fatalf("expected the upgrade span to end with the handshake, got %d spans", spans)
+	}
+	if status := exp.spanData(0)["output"].(map[string]any)["status_code"]; status != http.StatusSwitchingProtocols {
+		t.Errorf("status_code = %v, want 101", status)
+	}
+
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		t.Fatalf("101 response body %T is not writable", resp.Body)
+	}
+	if _, err := rwc.Write([]byte("ping")); err != nil {
+		t.Fatalf("write to upgraded connection failed: %v", err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(rwc, buf); err != nil || string(buf) != "ping" {
+		t.Errorf("echo = %q, %v; want \"ping\"", buf, err)
+	}
+	root.End()
+}
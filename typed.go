@@ -0,0 +1,65 @@
+package bitfab
+
+import "context"
+
+// Span executes fn inside a traced span, like Client.Span, but keeps the static
+// type of fn's result so callers don't need a type assertion:
+//
+//	order, err := bitfab.Span(ctx, client, "order-service", func(ctx context.Context) (Order, error) {
+//	    return loadOrder(ctx, id)
+//	}, bitfab.WithName("LoadOrder"))
+//
+// The result is captured as the span output and the error as the span error.
+// If the span options are invalid, fn is not called and the zero value of T
+// is returned with the error.
+func Span[T any](ctx context.Context, c *Client, traceFunctionKey string, fn func(ctx context.Context) (T, error), opts ...SpanOption) (T, error) {
+	var result T
+	_, err := c.Span(ctx, traceFunctionKey, func(ctx context.Context) (any, error) {
+		var fnErr error
+		result, fnErr = fn(ctx)
+		return result, fnErr
+	}, opts...)
+	return result, err
+}
+
+// FunctionSpan is the typed equivalent of Function.Span. It executes fn inside
+// a traced span using f's traceFunctionKey and returns fn's result as T.
+func FunctionSpan[T any](ctx context.Context, f *Function, fn func(ctx context.Context) (T, error), opts ...SpanOption) (T, error) {
+	return Span(ctx, f.client, f.traceFunctionKey, fn, opts...)
+}
+
+// Wrap1 returns a function with the same signature as fn that traces every
+// invocation in a span under f's traceFunctionKey. The argument is recorded as
+// the span input and the result as the span output:
+//
+//	summarize := bitfab.Wrap1(client.GetFunction("summarizer"), summarizeDoc, bitfab.WithType("llm"))
+//	summary, err := summarize(ctx, doc)
+//
+// opts apply to every invocation and take precedence over the captured input.
+func Wrap1[A, R any](f *Function, fn func(ctx context.Context, a A) (R, error), opts ...SpanOption) func(ctx context.Context, a A) (R, error) {
+	return func(ctx context.Context, a A) (R, error) {
+		return FunctionSpan(ctx, f, func(ctx context.Context) (R, error) {
+			return fn(ctx, a)
+		}, append([]SpanOption{WithInput(a)}, opts...)...)
+	}
+}
+
+// Wrap2 is like Wrap1 for functions taking two arguments. The arguments are
+// recorded as the span input in order.
+func Wrap2[A, B, R any](f *Function, fn func(ctx context.Context, a A, b B) (R, error), opts ...SpanOption) func(ctx context.Context, a A, b B) (R, error) {
+	return func(ctx context.Context, a A, b B) (R, error) {
+		return FunctionSpan(ctx, f, func(ctx context.Context) (R, error) {
+			return fn(ctx, a, b)
+		}, append([]SpanOption{WithInput(a, b)}, opts...)...)
+	}
+}
+
+// Wrap3 is like Wrap1 for functions taking three arguments. The arguments are
+// recorded as the span input in order.
+func Wrap3[A, B, C, R any](f *Function, fn func(ctx context.Context, a A, b B, c C) (R, error), opts ...SpanOption) func(ctx context.Context, a A, b B, c C) (R, error) {
+	return func(ctx context.Context, a A, b B, c C) (R, error) {
+		return FunctionSpan(ctx, f, func(ctx context.Context) (R, error) {
+			return fn(ctx, a, b, c)
+		}, append([]SpanOption{WithInput(a, b, c)}, opts...)...)
+	}
+}
@@ -0,0 +1,175 @@
+package bitfab
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type typedOrder struct {
+	ID    string `json:"id"`
+	Total int    `json:"total"`
+}
+
+func TestTypedSpan_ReturnsTypedResult(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	order, err := Span(context.Background(), client, "orders", func(ctx context.Context) (typedOrder, error) {
+		return typedOrder{ID: "o-1", Total: 42}, nil
+	}, WithName("LoadOrder"))
+
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if order.ID != "o-1" || order.Total != 42 {
+		t.Errorf("order = %+v", order)
+	}
+	spanData := exp.spanData(0)
+	if spanData["name"] != "LoadOrder" {
+		t.Errorf("name = %v, want LoadOrder", spanData["name"])
+	}
+	if got, ok := spanData["output"].(typedOrder); !ok || got != order {
+		t.Errorf("output = %v, want %+v", spanData["output"], order)
+	}
+}
+
+func TestTypedSpan_ReturnsError(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	n, err := Span(context.Background(), client, "count", func(ctx context.Context) (int, error) {
+		return 3, errors.New("partial failure")
+	})
+
+	if err == nil || err.Error() != "partial failure" {
+		t.Fatalf("err = %v, want partial failure", err)
+	}
+	if n != 3 {
+		t.Errorf("result = %d, want 3", n)
+	}
+	if exp.spanData(0)["error"] != "partial failure" {
+		t.Errorf("span error = %v", exp.spanData(0)["error"])
+	}
+}
+
+func TestTypedSpan_InvalidTypeReturnsZeroValue(t *testing.T) {
+	client := NewClient("test-key", WithExporter(&recordingExporter{}))
+	called := false
+
+	s, err := Span(context.Background(), client, "test", func(ctx context.Context) (string, error) {
+		called = true
+		return "value", nil
+	}, WithType("invalid"))
+
+	if err == nil {
+		t.Fatal("expected error for invalid type")
+	}
+	if called || s != "" {
+		t.Errorf("fn should not run for invalid options; called=%v result=%q", called, s)
+	}
+}
+
+func TestTypedSpan_DisabledClient(t *testing.T) {
+	client := NewClient("", WithEnabled(false))
+	got, err := Span(context.Background(), client, "test", func(ctx context.Context) ([]string, error) {
+		return []string{"a", "b"}, nil
+	})
+	if err != nil || len(got) != 2 {
+		t.Errorf("Span on disabled client = (%v, %v)", got, err)
+	}
+}
+
+func TestFunctionSpan_UsesFunctionKey(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+	fn := client.GetFunction("summarizer")
+
+	summary, err := FunctionSpan(context.Background(), fn, func(ctx context.Context) (string, error) {
+		return "short", nil
+	})
+
+	if err != nil || summary != "short" {
+		t.Fatalf("FunctionSpan = (%q, %v)", summary, err)
+	}
+	if exp.spans[0]["traceFunctionKey"] != "summarizer" {
+		t.Errorf("traceFunctionKey = %v, want summarizer", exp.spans[0]["traceFunctionKey"])
+	}
+}
+
+func TestWrap1_CapturesArgumentAndResult(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	double := Wrap1(client.GetFunction("math"), func(ctx context.Context, n int) (int, error) {
+		return n * 2, nil
+	}, WithName("Double"))
+
+	got, err := double(context.Background(), 21)
+	if err != nil || got != 42 {
+		t.Fatalf("double(21) = (%d, %v)", got, err)
+	}
+
+	spanData := exp.spanData(0)
+	if spanData["input"] != 21 {
+		t.Errorf("input = %v, want 21", spanData["input"])
+	}
+	if spanData["output"] != 42 {
+		t.Errorf("output = %v, want 42", spanData["output"])
+	}
+	if spanData["name"] != "Double" {
+		t.Errorf("name = %v, want Double", spanData["name"])
+	}
+	if exp.spans[0]["traceFunctionKey"] != "math" {
+		t.Errorf("traceFunctionKey = %v, want math", exp.spans[0]["traceFunctionKey"])
+	}
+}
+
+func TestWrap2_CapturesArgumentsInOrder(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	join := Wrap2(client.GetFunction("strings"), func(ctx context.Context, a string, b int) (string, error) {
+		return "", errors.New("join failed")
+	})
+
+	if _, err := join(context.Background(), "x", 3); err == nil {
+		t.Fatal("expected error")
+	}
+
+	spanData := exp.spanData(0)
+	input, ok := spanData["input"].([]any)
+	if !ok || len(input) != 2 || input[0] != "x" || input[1] != 3 {
+		t.Errorf("input = %v, want [x 3]", spanData["input"])
+	}
+	if spanData["error"] != "join failed" {
+		t.Errorf("error = %v, want join failed", spanData["error"])
+	}
+}
+
+func TestWrap3_EachCallIsASeparateSpan(t *testing.T) {
+	exp := &recordingExporter{}
+	client := NewClient("test-key", WithExporter(exp))
+
+	sum := Wrap3(client.GetFunction("math"), func(ctx context.Context, a, b, c int) (int, error) {
+		return a + b + c, nil
+	})
+
+	ctx, root := client.Start(context.Background(), "math", "Root")
+	sum(ctx, 1, 2, 3)
+	sum(ctx, 4, 5, 6)
+	root.End()
+
+	if len(exp.spans) != 3 {
+		t.Fatalf("exported %d spans, want 3", len(exp.spans))
+	}
+	for i, want := range []int{6, 15} {
+		raw := rawSpanOf(exp.spans[i])
+		if raw["parent_id"] != root.spanID {
+			t.Errorf("span %d parent_id = %v, want %s", i, raw["parent_id"], root.spanID)
+		}
+		if got := exp.spanData(i)["output"]; got != want {
+			t.Errorf("span %d output = %v, want %d", i, got, want)
+		}
+	}
+}